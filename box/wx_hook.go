@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"context"
 	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"fmt"
 	"github.com/laxiaohong/agave/encoding/json"
@@ -12,6 +15,12 @@ import (
 	"net/http"
 )
 
+const (
+	_maxContentBytes = 4096 // 微信机器人 markdown 消息内容的最大字节数
+	_maxFrames       = 5    // 通知中最多展示的栈帧数量
+	_maxStackLines   = 12   // 卡住请求的通知中最多展示的栈的行数
+)
+
 // 微信通知钩子的实现
 type wechatMarkdownWebHook struct {
 	WebHook string `json:"web_hook"`
@@ -36,14 +45,12 @@ func (c wechatMarkdownWebHook) Send(ctx context.Context, entry *ject.Entry) erro
 		v WxMarkdownContent
 	)
 
-	if data, err = json.Marshal(entry); err != nil {
-		return err
-	}
-
 	v = WxMarkdownContent{Msgtype: "markdown", Markdown: make(map[string]interface{})}
-	v.Markdown["content"] = fmt.Sprintf(`%s`, string(data))
+	v.Markdown["content"] = content(entry)
 
-	data, err = json.Marshal(v)
+	if data, err = json.Marshal(v); err != nil {
+		return err
+	}
 	buffer := bytes.NewBuffer(data)
 
 	// 构造请求体
@@ -73,3 +80,89 @@ func NewWechatMarkdownWebHook(webHook string) *wechatMarkdownWebHook {
 
 	return &wechatMarkdownWebHook{WebHook: webHook, Msgtype: "markdown"}
 }
+
+// 通知标题, 直接说明程序出了什么问题
+func headline(entry *ject.Entry) string {
+	switch {
+	case entry.Kind == ject.KindStatus:
+		return fmt.Sprintf("%s %s %s", entry.Message, entry.Method, entry.RequestURI)
+	case entry.Kind == ject.KindStuck:
+		return fmt.Sprintf("stuck %s %s %s", entry.Elapsed, entry.Method, entry.RequestURI)
+	case entry.PanicValue == "":
+		return entry.ServiceName
+	}
+	return fmt.Sprintf("%s: %s", entry.PanicType, entry.PanicValue)
+}
+
+// 通知内容, 按照报告的类型只保留定位问题需要的字段, 超过微信的长度限制时截断
+// 完整的报告(栈帧, 面包屑, 运行时快照)应该由其他钩子保存
+func content(entry *ject.Entry) string {
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, "### %s\n", headline(entry))
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(buf, "> %s: %s\n", name, value)
+		}
+	}
+
+	field("service", entry.ServiceName)
+	field("host", entry.HostName)
+	field("version", entry.Build.Version)
+	field("time", entry.CauseTime)
+	field("request_id", entry.RequestID)
+	field("request", strings.TrimSpace(entry.Method+" "+entry.RequestURI))
+	field("route", entry.Route)
+	field("client_ip", entry.ClientIP)
+
+	switch entry.Kind {
+	case ject.KindError:
+		field("error", entry.Message)
+	case ject.KindStatus:
+		field("status", strconv.Itoa(entry.Status))
+	case ject.KindStuck:
+		field("elapsed", entry.Elapsed)
+		lines := strings.Split(strings.TrimSpace(entry.Cause), "\n")
+		if len(lines) > _maxStackLines {
+			lines = lines[:_maxStackLines]
+		}
+		fmt.Fprintf(buf, "```\n%s\n```\n", strings.Join(lines, "\n"))
+	default:
+		field("fingerprint", entry.Fingerprint)
+		for _, f := range topFrames(entry.Frames) {
+			fmt.Fprintf(buf, "> `%s.%s` %s:%d\n", f.Package, f.Function, f.File, f.Line)
+		}
+	}
+
+	return truncate(buf.String(), _maxContentBytes)
+}
+
+// 优先展示业务代码的栈帧, 没有时展示除 runtime 之外的栈帧
+func topFrames(frames []ject.Frame) []ject.Frame {
+	picked := make([]ject.Frame, 0, _maxFrames)
+	for _, f := range frames {
+		if f.InApp && len(picked) < _maxFrames {
+			picked = append(picked, f)
+		}
+	}
+	if len(picked) > 0 {
+		return picked
+	}
+	for _, f := range frames {
+		if f.Package != "runtime" && len(picked) < _maxFrames {
+			picked = append(picked, f)
+		}
+	}
+	return picked
+}
+
+// 按字节截断, 不截断多字节字符
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	s = s[:max]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+// @desc:   请求级别的面包屑, 记录请求在崩溃之前打印的日志和执行的 SQL
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package crumb
+
+import (
+	"context"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const _maxMessage = 1 << 10 // 单条面包屑最多保留 1KB 的内容
+
+// 面包屑的类别
+const (
+	CategoryLog = "log" // pencil 打印的日志
+	CategorySQL = "sql" // witchy 记录的 SQL
+)
+
+// Crumb 一条面包屑
+type Crumb struct {
+	Time     string                 `json:"time"`              // 记录的时间
+	Category string                 `json:"category"`          // 类别, 比如: log, sql
+	Level    string                 `json:"level,omitempty"`   // 日志级别
+	Message  string                 `json:"message"`           // 日志内容或者 SQL 语句
+	Elapsed  string                 `json:"elapsed,omitempty"` // SQL 的执行时间
+	Data     map[string]interface{} `json:"data,omitempty"`    // 额外的信息, 比如影响的行数和错误
+}
+
+// Recorder 保存最近 N 条面包屑的环形缓冲区, 可以在多个协程中使用
+type Recorder struct {
+	mu    sync.Mutex
+	buf   []Crumb
+	next  int  // 下一条写入的位置
+	full  bool // 是否已经写满一圈
+	total int  // 累计记录的条数
+}
+
+// NewRecorder 构造最多保存 n 条面包屑的记录器
+func NewRecorder(n int) *Recorder {
+	if n <= 0 {
+		n = 1
+	}
+	return &Recorder{buf: make([]Crumb, n)}
+}
+
+// Add 记录一条面包屑, 超过容量时覆盖最老的面包屑, r 为 nil 时什么都不做
+func (r *Recorder) Add(c Crumb) {
+	if r == nil {
+		return
+	}
+	if c.Time == "" {
+		c.Time = time.Now().Format("2006-01-02 15:04:05.000")
+	}
+	if len(c.Message) > _maxMessage {
+		// 退到字符的边界, 不截断多字节字符
+		cut := _maxMessage
+		for cut > 0 && !utf8.RuneStart(c.Message[cut]) {
+			cut--
+		}
+		c.Message = c.Message[:cut] + "...[truncated]"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buf[r.next] = c
+	r.next = (r.next + 1) % len(r.buf)
+	r.total++
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Crumbs 按照时间顺序返回保存的面包屑
+func (r *Recorder) Crumbs() []Crumb {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]Crumb(nil), r.buf[:r.next]...)
+	}
+	out := make([]Crumb, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
+
+// Dropped 因为超过容量被覆盖的面包屑数量
+func (r *Recorder) Dropped() int {
+	if r == nil {
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.total <= len(r.buf) {
+		return 0
+	}
+	return r.total - len(r.buf)
+}
+
+type ctxKey struct{}
+
+// NewContext 把记录器写入上下文
+func NewContext(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, ctxKey{}, r)
+}
+
+// FromContext 从上下文中获取记录器, 没有时返回 nil
+func FromContext(ctx context.Context) *Recorder {
+	if ctx == nil {
+		return nil
+	}
+	r, _ := ctx.Value(ctxKey{}).(*Recorder)
+	return r
+}
+
+// Record 向上下文中的记录器写入一条面包屑, 上下文中没有记录器时什么都不做
+func Record(ctx context.Context, c Crumb) {
+	FromContext(ctx).Add(c)
+}
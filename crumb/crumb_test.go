@@ -0,0 +1,66 @@
+package crumb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRecorderRing(t *testing.T) {
+	r := NewRecorder(3)
+	for i := 0; i < 5; i++ {
+		r.Add(Crumb{Category: CategoryLog, Message: fmt.Sprint(i)})
+	}
+
+	crumbs := r.Crumbs()
+	var got []string
+	for _, c := range crumbs {
+		got = append(got, c.Message)
+	}
+	if strings.Join(got, ",") != "2,3,4" || r.Dropped() != 2 {
+		t.Fatalf("crumbs = %v, dropped = %d", got, r.Dropped())
+	}
+	if crumbs[0].Time == "" {
+		t.Fatal("time should be filled")
+	}
+}
+
+func TestRecorderTruncate(t *testing.T) {
+	r := NewRecorder(1)
+	r.Add(Crumb{Message: strings.Repeat("x", 2*_maxMessage)})
+	if msg := r.Crumbs()[0].Message; len(msg) > _maxMessage+20 || !strings.HasSuffix(msg, "[truncated]") {
+		t.Fatalf("message length %d", len(msg))
+	}
+
+	// 中文日志按字节截断时不能切开字符
+	r.Add(Crumb{Message: "x" + strings.Repeat("用户不存在", _maxMessage)})
+	if msg := r.Crumbs()[0].Message; !utf8.ValidString(msg) || len(msg) > _maxMessage+20 || !strings.HasSuffix(msg, "[truncated]") {
+		t.Fatalf("message %q", msg[len(msg)-20:])
+	}
+}
+
+func TestRecordContext(t *testing.T) {
+	// 上下文中没有记录器时不应该 panic
+	Record(context.Background(), Crumb{Message: "ignored"})
+
+	r := NewRecorder(100)
+	ctx := NewContext(context.Background(), r)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				Record(ctx, Crumb{Category: CategorySQL, Message: "select 1"})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if FromContext(ctx) != r || len(r.Crumbs()) != 100 || r.Dropped() != 0 {
+		t.Fatalf("recorded %d crumbs", len(r.Crumbs()))
+	}
+}
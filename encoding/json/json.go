@@ -1,6 +1,10 @@
 package json
 
-import jsoniter "github.com/json-iterator/go"
+import (
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+)
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
@@ -15,3 +19,7 @@ func Unmarshal(data []byte, v interface{}) error {
 func Valid(data []byte) bool {
 	return json.Valid(data)
 }
+
+func NewDecoder(reader io.Reader) *jsoniter.Decoder {
+	return json.NewDecoder(reader)
+}
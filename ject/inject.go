@@ -7,16 +7,23 @@ package ject
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/laxiaohong/agave/reqid"
+	"github.com/laxiaohong/agave/stamp"
 )
 
 const (
-	requestID   = "X-Trace-Id"
+	requestID   = reqid.DefaultHeader
 	serviceName = "https://github.com"
 )
 
@@ -35,8 +42,55 @@ type Inject struct {
 	GetRequestID      func(r *http.Request) string `json:"-"` // 获取请求 ID
 	GetRequestContent func(r *http.Request) string
 
-	Hooks      []Hook `json:"-"` // 钩子函数
-	ThrowPanic bool   // 是否继续向外抛出异常
+	ThrowPanic bool // 是否继续向外抛出异常
+
+	hooks *atomic.Value // 钩子函数, 保存 []*hookSlot, 修改时整体替换
+
+	async      bool           // 是否异步投递报告
+	queueSize  int            // 异步队列长度
+	workerNum  int            // 异步投递协程数
+	overflow   OverflowPolicy // 队列满时的处理策略
+	dispatcher *dispatcher    // 异步投递器
+
+	retry    RetryPolicy // 钩子投递失败后的重试策略
+	spoolDir string      // 死信目录
+	spool    *spool      // 死信, 保存重试之后仍然失败的报告
+
+	spoolPending map[string]struct{} // 启动时死信中还没有注册的钩子名字, 由 mu 保护
+
+	dedupWindow time.Duration // 相同指纹的去重窗口
+	deduper     *deduper      // 指纹去重
+
+	inAppPrefixes  []string // 业务代码的包前缀
+	collapseFrames bool     // 是否在文本栈中折叠非业务代码的栈帧
+
+	sourceContext   int          // 业务栈帧前后展示的源码行数
+	sourceCacheSize int          // 缓存的源码文件数量
+	sources         *sourceCache // 源码文件缓存
+
+	redactor *Redactor // 敏感数据过滤规则
+
+	bodyCaptureLimit int64 // 最多缓存的请求体字节数
+
+	ginEnricher    func(c *gin.Context, entry *Entry) // 从 gin 上下文中补充报告
+	trustedProxies []*net.IPNet                       // 可信的代理, 只有来自这些地址的转发请求头才会被采用
+
+	runtimeSnapshot bool // 是否附带运行时和进程的快照
+
+	ledgerPath string         // 记录 panic 首次出现版本的文件
+	ledger     *releaseLedger // panic 首次出现的版本
+
+	profile *profiler // panic 时采集协程和内存快照
+
+	breadcrumbs int // 每个请求最多保留的面包屑数量
+
+	reportStatus    map[int]struct{} // 需要报告的响应状态码
+	reportGinErrors bool             // 是否报告 c.Errors 不为空的请求
+
+	watchdog *watchdog // 卡住请求的检测
+
+	responder       Responder // panic 之后的响应
+	requestIDHeader string    // 回显请求 ID 的响应头
 }
 
 // 定义构造 Inject 类型
@@ -84,10 +138,32 @@ func SetGetRequestContent(f func(r *http.Request) string) InjectOption {
 	}
 }
 
-func (c *Inject) AddHook(h Hook) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.Hooks = append(c.Hooks, h)
+// 设置是否异步投递报告, 默认异步
+func SetAsync(async bool) InjectOption {
+	return func(c *Inject) {
+		c.async = async
+	}
+}
+
+// 设置异步队列长度
+func SetQueueSize(size int) InjectOption {
+	return func(c *Inject) {
+		c.queueSize = size
+	}
+}
+
+// 设置异步投递的协程数
+func SetWorkerNum(n int) InjectOption {
+	return func(c *Inject) {
+		c.workerNum = n
+	}
+}
+
+// 设置队列满时的处理策略
+func SetOverflowPolicy(p OverflowPolicy) InjectOption {
+	return func(c *Inject) {
+		c.overflow = p
+	}
 }
 
 // 构造 Inject 函数, opt 是可选的构造项
@@ -107,9 +183,23 @@ func NewInject(opt ...InjectOption) *Inject {
 	cj.GetRequestID = defaultGetRequestId
 	cj.GetRequestContent = defaultGetRequestContent
 
-	cj.Hooks = make([]Hook, 0, 4)
+	cj.hooks = &atomic.Value{}
+	cj.hooks.Store(make([]*hookSlot, 0, 4))
 	cj.ThrowPanic = false
 
+	cj.async = true
+	cj.queueSize = _defaultQueueSize
+	cj.workerNum = _defaultWorkerNum
+	cj.overflow = DropNewest
+	cj.retry = defaultRetryPolicy
+	cj.dedupWindow = _defaultDedupWindow
+	cj.sourceContext = _defaultSourceContext
+	cj.sourceCacheSize = _defaultSourceCacheSize
+	cj.redactor = DefaultRedactor()
+	cj.bodyCaptureLimit = _defaultBodyCaptureLimit
+	cj.responder = DefaultResponder
+	cj.requestIDHeader = requestID
+
 	for _, ijOpt := range opt {
 		if ijOpt == nil {
 			continue
@@ -118,26 +208,137 @@ func NewInject(opt ...InjectOption) *Inject {
 		ijOpt(&cj)
 	}
 
+	cj.sources = newSourceCache(cj.sourceCacheSize)
+
+	if cj.ledgerPath != "" {
+		ledger, err := newReleaseLedger(cj.ledgerPath)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "ject: release ledger err:%s\n", err)
+		} else {
+			cj.ledger = ledger
+		}
+	}
+
+	if cj.dedupWindow > 0 {
+		cj.deduper = newDeduper(cj.dedupWindow)
+	}
+
+	if cj.spoolDir != "" {
+		sp, err := newSpool(cj.spoolDir)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "ject: spool err:%s\n", err)
+		} else {
+			cj.spool = sp
+			cj.spoolPending = sp.pendingHooks()
+		}
+	}
+
+	if cj.async {
+		cj.dispatcher = newDispatcher(cj.queueSize, cj.workerNum, cj.overflow, cj.fireHooks)
+	}
+
+	if cj.watchdog != nil {
+		cj.watchdog.start(cj.reportStuck)
+	}
+
 	return &cj
 }
 
+// 投递报告, 异步模式下进入队列, 否则同步调用钩子
+// 继续向外抛出异常时进程可能随即退出, 所以同步投递
+func (c *Inject) dispatch(entry *Entry) {
+	if !c.admit(entry) {
+		return
+	}
+
+	if c.dispatcher == nil || c.ThrowPanic {
+		c.fireHooks(entry)
+		return
+	}
+
+	if err := c.dispatcher.enqueue(entry); err != nil {
+		reportDropped(entry, err)
+	}
+}
+
+// 依次调用钩子
+func (c *Inject) fireHooks(entry *Entry) {
+	for _, v := range c.loadHooks() {
+		if v.enabled() {
+			c.deliver(v, entry)
+		}
+	}
+}
+
+// 调用单个钩子, 重试之后仍然失败的报告写入死信目录, 自动命名的钩子不写入
+func (c *Inject) deliver(s *hookSlot, entry *Entry) {
+	err := c.fireWithRetry(entry.Ctx, s, entry)
+	if err == nil {
+		return
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "err:%s", err)
+	if c.spool == nil || !s.named {
+		return
+	}
+	if err = c.spool.write(s.name, entry); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "ject: spool err:%s\n", err)
+	}
+}
+
+// Shutdown 停止卡住请求的检测和接收新的报告, 并等待队列中的报告以及 Async 钩子在后台的调用投递完毕
+func (c *Inject) Shutdown(ctx context.Context) error {
+	if c.watchdog != nil {
+		if err := c.watchdog.stop(ctx); err != nil {
+			return err
+		}
+	}
+
+	if c.dispatcher != nil {
+		if err := c.dispatcher.shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
+	// 队列投递完之后, 等待 Async 等装饰器在后台执行的调用
+	for _, s := range c.loadHooks() {
+		if err := drainHook(ctx, s.hook); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 构造报告, r 为空时只填充机器和服务的信息, 比如 gRPC 等非 HTTP 的场景
+// 报告的上下文只保留 ctx 中的值, 请求结束之后异步投递的钩子不会被取消
 func (c *Inject) NewEntry(ctx context.Context, r *http.Request, cause string) *Entry {
+	entry := &Entry{
+		Ctx:         detach(ctx),
+		Cause:       cause,
+		CauseTime:   c.TimeFormatter(time.Now()),
+		HostName:    c.HostName,
+		GOOS:        c.GOOS,
+		GOARCH:      c.GOARCH,
+		ServiceName: c.ServiceName,
+		GOVersion:   c.GOVersion,
+		Build:       stamp.Get(),
+		Data:        make(map[string]interface{}, 4),
+	}
 
-	return &Entry{
-		Ctx:            ctx,
-		Cause:          cause,
-		CauseTime:      c.TimeFormatter(time.Now()),
-		RequestID:      c.GetRequestID(r),
-		RequestContent: c.PurgeRequest(c.GetRequestContent(r)),
-		RequestURI:     r.RequestURI,
-		Method:         r.Method,
-		HostName:       c.HostName,
-		GOOS:           c.GOOS,
-		GOARCH:         c.GOARCH,
-		ServiceName:    c.ServiceName,
-		GOVersion:      c.GOVersion,
-		Data:           make(map[string]interface{}, 4),
+	if r != nil {
+		entry.RequestID = c.GetRequestID(r)
+		entry.RequestContent = c.PurgeRequest(c.redactor.Redact(c.GetRequestContent(r)))
+		entry.RequestURI = c.redactor.RedactURI(r.RequestURI)
+		entry.Method = r.Method
+		entry.RemoteAddr = r.RemoteAddr
+		entry.ClientIP = c.clientIP(r)
+		entry.UserAgent = r.UserAgent()
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = reqid.FromContext(ctx)
 	}
+
+	return entry
 }
 
 var (
@@ -148,18 +349,45 @@ var (
 	_ = SetServiceName
 	_ = SetThrowPanic
 	_ = SetGetRequestContent
+	_ = SetAsync
+	_ = SetQueueSize
+	_ = SetWorkerNum
+	_ = SetOverflowPolicy
+	_ = SetRetryPolicy
+	_ = SetSpoolDir
+	_ = SetDedupWindow
+	_ = SetInAppPrefixes
+	_ = SetCollapseFrames
+	_ = SetSourceContext
+	_ = SetSourceCacheSize
+	_ = SetRedactor
+	_ = SetBodyCaptureLimit
+	_ = SetGinEnricher
+	_ = SetTrustedProxies
+	_ = SetRuntimeSnapshot
+	_ = SetReleaseLedger
+	_ = SetProfileCapture
+	_ = SetResponder
+	_ = SetRequestIDHeader
+	_ = SetBreadcrumbs
+	_ = SetReportStatusCodes
+	_ = SetReportGinErrors
+	_ = SetWatchdog
 )
 
-// 默认不过滤用户敏感信息
+// 默认不做额外的处理, 敏感信息由 Redactor 过滤
 func defaultPurgeRequest(s string) string {
 	return s
 }
 
-// 获取请求 id
+// 获取请求 id, 优先使用 reqid 中间件写入上下文的请求 ID
 func defaultGetRequestId(r *http.Request) string {
 	if r == nil {
 		return ""
 	}
+	if id := reqid.FromContext(r.Context()); id != "" {
+		return id
+	}
 	return r.Header.Get(requestID)
 }
 
@@ -169,8 +397,13 @@ func defaultTimeFormatter(t time.Time) string {
 	return timeString
 }
 
-// 获取请求内容
+// 获取请求内容, 请求体优先使用拦截器缓存的内容, 业务代码读取过请求体也能重放
 func defaultGetRequestContent(r *http.Request) string {
+	if body, ok := capturedBody(r); ok {
+		data, _ := httputil.DumpRequest(r, false)
+		return string(data) + string(body)
+	}
+
 	data, _ := httputil.DumpRequest(r, true)
 	return string(data)
 }
@@ -0,0 +1,188 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	_defaultBodyCaptureLimit = 64 << 10              // 默认最多缓存 64KB 的请求体
+	_bodyReadTimeout         = 50 * time.Millisecond // 补读请求体时最多等待的时间
+)
+
+// 只记录大小, 不缓存内容的请求体类型
+var binaryContentTypes = []string{
+	"multipart/",
+	"application/octet-stream",
+	"application/zip",
+	"application/gzip",
+	"application/pdf",
+	"application/x-protobuf",
+	"application/grpc",
+	"image/",
+	"audio/",
+	"video/",
+}
+
+// 设置最多缓存的请求体字节数, 小于等于 0 时不缓存请求体
+func SetBodyCaptureLimit(n int64) InjectOption {
+	return func(c *Inject) {
+		c.bodyCaptureLimit = n
+	}
+}
+
+type bodyKey struct{}
+
+// bodyRecorder 在业务代码读取请求体的同时缓存请求体, 用于 panic 之后重放请求
+type bodyRecorder struct {
+	mu        sync.Mutex
+	rc        io.ReadCloser
+	buf       bytes.Buffer
+	limit     int64
+	total     int64 // 已经读取的字节数
+	eof       bool  // 请求体是否已经读完
+	draining  bool  // 是否已经开始补读
+	binary    bool  // 二进制或者文件上传, 只记录大小
+	mediaType string
+}
+
+func (b *bodyRecorder) Read(p []byte) (int, error) {
+	n, err := b.rc.Read(p)
+
+	b.mu.Lock()
+	b.record(p[:n], err)
+	b.mu.Unlock()
+
+	return n, err
+}
+
+func (b *bodyRecorder) Close() error {
+	return b.rc.Close()
+}
+
+func (b *bodyRecorder) record(p []byte, err error) {
+	b.total += int64(len(p))
+	if err == io.EOF {
+		b.eof = true
+	}
+	if b.binary {
+		return
+	}
+	if remain := b.limit - int64(b.buf.Len()); remain > 0 {
+		if int64(len(p)) > remain {
+			p = p[:remain]
+		}
+		b.buf.Write(p)
+	}
+}
+
+// 在后台补读业务代码没有读完的请求体, 最多读到上限之后的一个字节, 用于判断是否截断
+// 客户端发送缓慢时最多等待 timeout, 超时之后只使用已经读到的内容, 不阻塞 panic 的处理
+func (b *bodyRecorder) readRest(timeout time.Duration) {
+	b.mu.Lock()
+	if b.eof || b.binary || b.draining || b.total > b.limit {
+		b.mu.Unlock()
+		return
+	}
+	b.draining = true
+	remain := b.limit + 1 - b.total
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, remain)
+		for remain > 0 {
+			n, err := b.rc.Read(buf[:remain])
+			b.mu.Lock()
+			b.record(buf[:n], err)
+			b.mu.Unlock()
+			remain -= int64(n)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+}
+
+// 返回缓存的请求体, 业务代码没有读完的部分先补读
+// 读到的字节数超过上限时标记为截断, 超时没有读完时标记为未读完
+func (b *bodyRecorder) content() []byte {
+	b.readRest(_bodyReadTimeout)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.binary {
+		return []byte(fmt.Sprintf("[%s body omitted, %d bytes read]", b.mediaType, b.total))
+	}
+	if !utf8.Valid(b.buf.Bytes()) {
+		return []byte(fmt.Sprintf("[binary body omitted, %d bytes read]", b.total))
+	}
+
+	data := append([]byte(nil), b.buf.Bytes()...)
+	switch {
+	case b.total > b.limit:
+		data = append(data, fmt.Sprintf("\n...[truncated, %d bytes captured]", len(data))...)
+	case !b.eof:
+		data = append(data, fmt.Sprintf("\n...[incomplete, %d bytes captured]", len(data))...)
+	}
+	return data
+}
+
+// 包装请求体, 返回携带缓存的请求
+func (c *Inject) captureBody(r *http.Request) *http.Request {
+	if c.bodyCaptureLimit <= 0 || r.Body == nil || r.Body == http.NoBody {
+		return r
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	rec := &bodyRecorder{
+		rc:        r.Body,
+		limit:     c.bodyCaptureLimit,
+		binary:    isBinaryContent(mediaType),
+		mediaType: mediaType,
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), bodyKey{}, rec))
+	r.Body = rec
+	return r
+}
+
+func isBinaryContent(mediaType string) bool {
+	for _, prefix := range binaryContentTypes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 从请求中获取缓存的请求体
+func capturedBody(r *http.Request) ([]byte, bool) {
+	rec, ok := r.Context().Value(bodyKey{}).(*bodyRecorder)
+	if !ok {
+		return nil, false
+	}
+	return rec.content(), true
+}
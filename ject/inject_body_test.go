@@ -0,0 +1,115 @@
+package ject
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBodyCapturedAfterHandlerRead(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetDedupWindow(0), SetBodyCaptureLimit(16))
+	cj.AddHook(hook)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(RecoveryHandlerFunc(cj))
+	engine.POST("/consume", func(c *gin.Context) {
+		_, _ = ioutil.ReadAll(c.Request.Body)
+		panic("after read")
+	})
+	engine.POST("/ignore", func(c *gin.Context) {
+		panic("before read")
+	})
+
+	for _, tc := range []struct {
+		path, contentType, body, want string
+	}{
+		{"/consume", "application/json", `{"order":1}`, "\r\n\r\n" + `{"order":1}`},
+		{"/ignore", "text/plain", "unread body", "\r\n\r\nunread body"},
+		{"/consume", "text/plain", "0123456789abcdefXYZ", "0123456789abcdef\n...[truncated, 16 bytes captured]"},
+		{"/consume", "multipart/form-data; boundary=x", "--x--", "[multipart/form-data body omitted, 5 bytes read]"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", tc.contentType)
+		engine.ServeHTTP(httptest.NewRecorder(), r)
+
+		got := hook.entries[len(hook.entries)-1].RequestContent
+		if !strings.HasSuffix(got, tc.want) {
+			t.Errorf("%s %s: request content %q, want suffix %q", tc.path, tc.contentType, got, tc.want)
+		}
+	}
+}
+
+func TestBodyCaptureLimitBoundary(t *testing.T) {
+	const limit = 16
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetDedupWindow(0), SetBodyCaptureLimit(limit))
+	cj.AddHook(hook)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(RecoveryHandlerFunc(cj))
+	engine.POST("/consume", func(c *gin.Context) {
+		_, _ = ioutil.ReadAll(c.Request.Body)
+		panic("after read")
+	})
+	engine.POST("/ignore", func(c *gin.Context) {
+		panic("before read")
+	})
+
+	for _, path := range []string{"/consume", "/ignore"} {
+		for _, size := range []int{limit - 1, limit, limit + 1} {
+			body := strings.Repeat("a", size)
+			r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			r.Header.Set("Content-Type", "text/plain")
+			engine.ServeHTTP(httptest.NewRecorder(), r)
+
+			want := "\r\n\r\n" + body
+			if size > limit {
+				want = "\r\n\r\n" + body[:limit] + "\n...[truncated, 16 bytes captured]"
+			}
+			if got := hook.entries[len(hook.entries)-1].RequestContent; !strings.HasSuffix(got, want) {
+				t.Errorf("%s size %d: request content %q, want suffix %q", path, size, got, want)
+			}
+		}
+	}
+}
+
+func TestBodyCaptureSlowClient(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetBodyCaptureLimit(16))
+	cj.AddHook(hook)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(RecoveryHandlerFunc(cj))
+	engine.POST("/", func(c *gin.Context) {
+		buf := make([]byte, 4)
+		_, _ = io.ReadFull(c.Request.Body, buf)
+		panic("slow client")
+	})
+
+	// 客户端发送了一部分之后停住, 补读不能阻塞 panic 的处理
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() { _, _ = pw.Write([]byte("head")) }()
+
+	r := httptest.NewRequest(http.MethodPost, "/", pr)
+	r.Header.Set("Content-Type", "text/plain")
+	start := time.Now()
+	engine.ServeHTTP(httptest.NewRecorder(), r)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("recovery blocked for %s", elapsed)
+	}
+
+	if got := hook.entries[0].RequestContent; !strings.HasSuffix(got, "\r\n\r\nhead\n...[incomplete, 4 bytes captured]") {
+		t.Fatalf("request content %q", got)
+	}
+}
@@ -0,0 +1,57 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/laxiaohong/agave/crumb"
+)
+
+// 设置每个请求最多保留的面包屑数量, 面包屑由 pencil 的日志和 witchy 的 SQL 写入, 小于等于 0 时不记录
+func SetBreadcrumbs(n int) InjectOption {
+	return func(c *Inject) {
+		c.breadcrumbs = n
+	}
+}
+
+// 在上下文中放入面包屑记录器, 上游已经放入时直接使用
+func (c *Inject) breadcrumbContext(ctx context.Context) context.Context {
+	if c.breadcrumbs <= 0 || crumb.FromContext(ctx) != nil {
+		return ctx
+	}
+	return crumb.NewContext(ctx, crumb.NewRecorder(c.breadcrumbs))
+}
+
+// 返回携带面包屑记录器的请求, 业务代码通过 c.Request.Context() 打印日志时才能被记录
+func (c *Inject) trackBreadcrumbs(r *http.Request) *http.Request {
+	ctx := c.breadcrumbContext(r.Context())
+	if ctx == r.Context() {
+		return r
+	}
+	return r.WithContext(ctx)
+}
+
+// 把上下文中的面包屑附加到报告, 日志和 SQL 中可能有敏感数据, 按照字段规则屏蔽并执行正则检测
+func (c *Inject) attachBreadcrumbs(entry *Entry) {
+	rec := crumb.FromContext(entry.Ctx)
+	if rec == nil {
+		return
+	}
+
+	entry.Breadcrumbs = rec.Crumbs()
+	if dropped := rec.Dropped(); dropped > 0 {
+		entry.Data["breadcrumbs_dropped"] = dropped
+	}
+	if c.redactor == nil {
+		return
+	}
+	pattern := c.redactor.textPattern()
+	for i := range entry.Breadcrumbs {
+		entry.Breadcrumbs[i].Message = c.redactor.redactText(pattern, entry.Breadcrumbs[i].Message)
+	}
+}
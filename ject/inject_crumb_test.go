@@ -0,0 +1,90 @@
+package ject
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/laxiaohong/agave/crumb"
+)
+
+func TestBreadcrumbs(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetBreadcrumbs(2))
+	cj.AddHook(hook)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(RecoveryHandlerFunc(cj))
+	engine.GET("/", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		crumb.Record(ctx, crumb.Crumb{Category: crumb.CategoryLog, Level: "INFO", Message: "start"})
+		crumb.Record(ctx, crumb.Crumb{Category: crumb.CategorySQL, Message: "select * from user where phone = '13812345678'", Elapsed: "1ms"})
+		crumb.Record(ctx, crumb.Crumb{Category: crumb.CategoryLog, Level: "WARN", Message: "user not found"})
+		panic("nil user")
+	})
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	e := hook.entries[0]
+	if len(e.Breadcrumbs) != 2 || e.Data["breadcrumbs_dropped"] != 1 {
+		t.Fatalf("breadcrumbs = %+v, data = %v", e.Breadcrumbs, e.Data)
+	}
+	if sql := e.Breadcrumbs[0]; sql.Category != crumb.CategorySQL || sql.Message != "select * from user where phone = '138****5678'" {
+		t.Fatalf("unexpected sql crumb %+v", sql)
+	}
+	if e.Breadcrumbs[1].Message != "user not found" {
+		t.Fatalf("unexpected last crumb %+v", e.Breadcrumbs[1])
+	}
+}
+
+func TestBreadcrumbsDisabled(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false))
+	cj.AddHook(hook)
+
+	handler := RecoveryHandler(cj, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if crumb.FromContext(r.Context()) != nil {
+			t.Error("recorder should not be installed by default")
+		}
+		panic("boom")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if hook.entries[0].Breadcrumbs != nil {
+		t.Fatalf("breadcrumbs = %+v", hook.entries[0].Breadcrumbs)
+	}
+}
+
+func TestBreadcrumbsRedactFields(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetBreadcrumbs(8))
+	cj.AddHook(hook)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(RecoveryHandlerFunc(cj))
+	engine.GET("/", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		crumb.Record(ctx, crumb.Crumb{Category: crumb.CategorySQL, Message: "UPDATE `user` SET `password` = 'p@ss\\'word', name = 'tom' WHERE id = 1"})
+		crumb.Record(ctx, crumb.Crumb{Category: crumb.CategorySQL, Message: `SELECT * FROM user WHERE name = "tom" AND pwd="123456"`})
+		crumb.Record(ctx, crumb.Crumb{Category: crumb.CategoryLog, Message: `call /login?token=abc&page=1 body {"access_token":"xyz","user":"tom"}`})
+		panic("redact")
+	})
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := []string{
+		"UPDATE `user` SET `password` = '******', name = 'tom' WHERE id = 1",
+		`SELECT * FROM user WHERE name = "tom" AND pwd="******"`,
+		`call /login?token=******&page=1 body {"access_token":"******","user":"tom"}`,
+	}
+	crumbs := hook.entries[0].Breadcrumbs
+	if len(crumbs) != len(want) {
+		t.Fatalf("breadcrumbs = %+v", crumbs)
+	}
+	for i, w := range want {
+		if crumbs[i].Message != w {
+			t.Errorf("crumb %d = %s, want %s", i, crumbs[i].Message, w)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// 队列满时的处理策略
+type OverflowPolicy int
+
+const (
+	DropNewest OverflowPolicy = iota // 丢弃最新的报告
+	DropOldest                       // 丢弃队列中最老的报告
+	Block                            // 阻塞直到队列有空位
+)
+
+const (
+	_defaultQueueSize = 256 // 默认队列长度
+	_defaultWorkerNum = 2   // 默认投递协程数
+)
+
+var (
+	// ErrInjectClosed 在 Shutdown 之后继续投递时返回
+	ErrInjectClosed = errors.New("ject: inject is shut down")
+	// ErrQueueFull 队列已满, 按照 DropNewest 策略丢弃报告时返回
+	ErrQueueFull = errors.New("ject: queue full")
+)
+
+// dispatcher 有界队列 + 协程池, 在后台把 Entry 投递给钩子
+type dispatcher struct {
+	mu     sync.RWMutex
+	queue  chan *Entry
+	policy OverflowPolicy
+	closed bool
+	done   chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
+}
+
+func newDispatcher(size, workers int, policy OverflowPolicy, fire func(*Entry)) *dispatcher {
+	if size <= 0 {
+		size = _defaultQueueSize
+	}
+	if workers <= 0 {
+		workers = _defaultWorkerNum
+	}
+
+	d := &dispatcher{
+		queue:  make(chan *Entry, size),
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+
+	d.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer d.wg.Done()
+			for entry := range d.queue {
+				fire(entry)
+			}
+		}()
+	}
+
+	return d
+}
+
+// 投递报告, 报告被丢弃时返回 ErrQueueFull, Shutdown 之后返回 ErrInjectClosed
+func (d *dispatcher) enqueue(entry *Entry) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrInjectClosed
+	}
+
+	select {
+	case d.queue <- entry:
+		return nil
+	default:
+	}
+
+	switch d.policy {
+	case DropOldest:
+		for {
+			select {
+			case <-d.queue:
+			default:
+			}
+			select {
+			case d.queue <- entry:
+				return nil
+			default:
+			}
+		}
+	case Block:
+		select {
+		case d.queue <- entry:
+			return nil
+		case <-d.done:
+			return ErrInjectClosed
+		}
+	default:
+		return ErrQueueFull
+	}
+}
+
+// 不等待地投递报告, 忽略 Block 策略, 用于不能被钩子阻塞的调用者
+func (d *dispatcher) offer(entry *Entry) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrInjectClosed
+	}
+
+	select {
+	case d.queue <- entry:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// 关闭队列, 等待已入队的报告投递完毕
+func (d *dispatcher) shutdown(ctx context.Context) error {
+	// 先唤醒阻塞在 Block 策略上的投递者, 再拿写锁关闭队列
+	d.once.Do(func() { close(d.done) })
+
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 丢弃报告时输出到标准错误
+func reportDropped(entry *Entry, err error) {
+	_, _ = fmt.Fprintf(os.Stderr, "%s, drop entry request_id:%s\n", err, entry.RequestID)
+}
@@ -0,0 +1,111 @@
+package ject
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type countHook struct {
+	mu      sync.Mutex
+	entries []*Entry
+	block   chan struct{}
+}
+
+func (h *countHook) Fire(ctx context.Context, entry *Entry) error {
+	if h.block != nil {
+		<-h.block
+	}
+	h.mu.Lock()
+	h.entries = append(h.entries, entry)
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *countHook) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.entries)
+}
+
+func TestDispatchShutdownDrains(t *testing.T) {
+	cj := NewInject(SetQueueSize(16), SetWorkerNum(1))
+	hook := &countHook{}
+	cj.AddHook(hook)
+
+	for i := 0; i < 10; i++ {
+		cj.dispatch(&Entry{Ctx: context.Background()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := cj.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := hook.count(); got != 10 {
+		t.Fatalf("delivered %d entries, want 10", got)
+	}
+}
+
+func TestDispatchOverflowPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy OverflowPolicy
+		want   []string
+	}{
+		{"drop newest", DropNewest, []string{"0", "1", "2"}},
+		{"drop oldest", DropOldest, []string{"0", "3", "4"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cj := NewInject(SetQueueSize(2), SetWorkerNum(1), SetOverflowPolicy(tc.policy))
+			hook := &countHook{block: make(chan struct{})}
+			cj.AddHook(hook)
+
+			// 第一个报告被协程取走后阻塞在钩子里, 其余的留在队列中
+			cj.dispatch(&Entry{Ctx: context.Background(), RequestID: "0"})
+			time.Sleep(20 * time.Millisecond)
+			for _, id := range []string{"1", "2", "3", "4"} {
+				cj.dispatch(&Entry{Ctx: context.Background(), RequestID: id})
+			}
+			close(hook.block)
+
+			if err := cj.Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if len(hook.entries) != len(tc.want) {
+				t.Fatalf("delivered %d entries, want %d", len(hook.entries), len(tc.want))
+			}
+			for i, e := range hook.entries {
+				if e.RequestID != tc.want[i] {
+					t.Fatalf("entry %d = %s, want %s", i, e.RequestID, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEnqueueErrors(t *testing.T) {
+	block := make(chan struct{})
+	d := newDispatcher(1, 1, DropNewest, func(*Entry) { <-block })
+
+	// 第一个报告被协程取走后阻塞, 第二个占满队列, 第三个被丢弃
+	if err := d.enqueue(&Entry{}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := d.enqueue(&Entry{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.enqueue(&Entry{}); err != ErrQueueFull {
+		t.Fatalf("full queue err = %v", err)
+	}
+
+	close(block)
+	if err := d.shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.enqueue(&Entry{}); err != ErrInjectClosed {
+		t.Fatalf("enqueue after shutdown err = %v", err)
+	}
+}
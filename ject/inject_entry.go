@@ -5,20 +5,83 @@
 
 package ject
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/laxiaohong/agave/crumb"
+	"github.com/laxiaohong/agave/stamp"
+)
 
 type Entry struct {
 	Ctx            context.Context        `json:"-"`               // 上下文信息
-	Cause          string                 `json:"cause"`           // 程序崩溃的原因
+	Kind           string                 `json:"kind"`            // 报告的类型: panic, error, status, stuck
+	Cause          string                 `json:"cause"`           // 程序崩溃的原因, 文本格式的调用栈, 只有 panic 和 stuck 类型的报告才有
+	Message        string                 `json:"message"`         // 报告的摘要, error 类型是 c.Errors 的文本, status 类型是状态码和状态文本
+	Frames         []Frame                `json:"frames"`          // 结构化的调用栈
 	CauseTime      string                 `json:"cause_time"`      // 程序崩溃的时间
 	RequestContent string                 `json:"request_content"` // HTTP 请求的内容, 用于重放, 复现 panic 场景
 	RequestID      string                 `json:"request_id"`      // 请求 ID
+	TraceID        string                 `json:"trace_id"`        // OpenTelemetry trace ID, 上下文中没有 span 时为空
+	SpanID         string                 `json:"span_id"`         // OpenTelemetry span ID
 	RequestURI     string                 `json:"request_uri"`     // 请求路径
 	Method         string                 `json:"method"`          // 请求方法
+	RemoteAddr     string                 `json:"remote_addr"`     // 对端地址
+	Goroutine      string                 `json:"goroutine"`       // 协程的逻辑名称, 只有通过 Go 和 Group 启动的协程才有
+	ClientIP       string                 `json:"client_ip"`       // 客户端 IP
+	UserAgent      string                 `json:"user_agent"`      // 客户端 UA
+	Route          string                 `json:"route"`           // 匹配到的路由模板, 比如: /user/:id
+	Handler        string                 `json:"handler"`         // 正在执行的处理函数
+	Elapsed        string                 `json:"elapsed"`         // panic 时请求已经执行的时间
+	Written        bool                   `json:"written"`         // panic 时是否已经写出了响应头
+	Status         int                    `json:"status"`          // panic 时响应的状态码
+	Size           int                    `json:"size"`            // panic 时已经写出的响应体字节数, -1 表示还没有写出
 	HostName       string                 `json:"host_name"`       // 主机名, 多机部署时有用
 	GOOS           string                 `json:"goos"`            // 系统
 	GOARCH         string                 `json:"goarch"`          // 系统架构
 	ServiceName    string                 `json:"service_name"`    // 服务名称
 	GOVersion      string                 `json:"go_version"`      // golang 的版本信息
 	Data           map[string]interface{} `json:"data"`            // 额外的信息
+
+	PanicValue   string      `json:"panic_value"`   // panic 的值, 比如: runtime error: index out of range [233] with length 233, 类型为 error 时是最外层错误的 Error(), 内层错误见 ErrorChain
+	PanicType    string      `json:"panic_type"`    // panic 值的 go 类型
+	RuntimeError bool        `json:"runtime_error"` // 是否是运行时错误(空指针, 数组越界等)
+	ErrorChain   []ErrorLink `json:"error_chain"`   // panic 值是 error 时, 通过 errors.Unwrap 展开的错误链
+
+	Build            stamp.Info `json:"build"`              // 构建信息
+	FirstSeenRelease string     `json:"first_seen_release"` // 该 panic 首次出现的版本, 需要开启 SetReleaseLedger
+	NewInRelease     bool       `json:"new_in_release"`     // 该 panic 是否是当前版本新出现的, 首次出现的版本是当前版本时, 之后的每次报告都是 true
+
+	Runtime *RuntimeSnapshot `json:"runtime,omitempty"` // 运行时和进程的快照, 需要开启 SetRuntimeSnapshot
+
+	Breadcrumbs []crumb.Crumb `json:"breadcrumbs,omitempty"` // panic 之前请求打印的日志和执行的 SQL, 需要开启 SetBreadcrumbs
+
+	Fingerprint      string `json:"fingerprint"`       // panic 指纹, 相同原因的 panic 指纹相同
+	Occurrences      int64  `json:"occurrences"`       // 自上一次报告以来发生的次数, 包含本次
+	OccurrenceWindow string `json:"occurrence_window"` // 距离上一次报告的时间
+}
+
+// 错误链中的一环
+type ErrorLink struct {
+	Type    string `json:"type"`    // 错误的 go 类型
+	Message string `json:"message"` // 错误信息
+}
+
+// 记录 panic 的值
+func (e *Entry) setPanic(v interface{}) {
+	e.PanicValue = fmt.Sprint(v)
+	e.PanicType = fmt.Sprintf("%T", v)
+
+	err, ok := v.(error)
+	if !ok {
+		return
+	}
+
+	var re runtime.Error
+	e.RuntimeError = errors.As(err, &re)
+	for ; err != nil; err = errors.Unwrap(err) {
+		e.ErrorChain = append(e.ErrorChain, ErrorLink{Type: fmt.Sprintf("%T", err), Message: err.Error()})
+	}
 }
@@ -0,0 +1,137 @@
+package ject
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laxiaohong/agave/encoding/json"
+)
+
+func TestEntrySetPanic(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false))
+	cj.AddHook(hook)
+	serve(newPanicEngine(cj), "/index")
+
+	entry := hook.entries[0]
+	if !entry.RuntimeError || entry.PanicValue != "runtime error: index out of range [1] with length 1" {
+		t.Fatalf("unexpected panic value %q runtime=%v", entry.PanicValue, entry.RuntimeError)
+	}
+	if entry.PanicType != "runtime.boundsError" {
+		t.Fatalf("unexpected panic type %q", entry.PanicType)
+	}
+
+	wrapped := fmt.Errorf("load config: %w", &os.PathError{Op: "open", Path: "a.yaml", Err: os.ErrNotExist})
+	e := &Entry{}
+	e.setPanic(wrapped)
+	if e.RuntimeError || len(e.ErrorChain) != 3 {
+		t.Fatalf("unexpected chain %+v", e.ErrorChain)
+	}
+	if e.ErrorChain[1].Type != fmt.Sprintf("%T", &os.PathError{}) || e.ErrorChain[2].Message != os.ErrNotExist.Error() {
+		t.Fatalf("unexpected chain %+v", e.ErrorChain)
+	}
+}
+
+func TestRuntimeSnapshot(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetRuntimeSnapshot(true))
+	cj.AddHook(hook)
+	serve(newPanicEngine(cj), "/nil")
+
+	snap := hook.entries[0].Runtime
+	if snap == nil || snap.PID != os.Getpid() || snap.NumGoroutine == 0 || snap.GOMAXPROCS == 0 || snap.Mem.Sys == 0 {
+		t.Fatalf("unexpected snapshot %+v", snap)
+	}
+	if runtime.GOOS == "linux" && snap.OpenFDs <= 0 {
+		t.Fatalf("open fds = %d", snap.OpenFDs)
+	}
+}
+
+func TestMatchContainerID(t *testing.T) {
+	id := "3f1c0a9d2b7e4c6f8a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f6071"
+	layer := "9b0c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c"
+
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"cgroup v1 docker", "12:pids:/docker/" + id, id},
+		{"cgroup v1 kubepods", "11:cpu,cpuacct:/kubepods/burstable/pod0c9d3f3e-6a1b-4c7d-9e2f-1a2b3c4d5e6f/" + id, id},
+		{"cgroup v1 systemd", "1:name=systemd:/system.slice/docker-" + id + ".scope", id},
+		{"cgroup v2 docker", "0::/system.slice/docker-" + id + ".scope", id},
+		{"cgroup v2 containerd", "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0c9d3f3e_6a1b.slice/cri-containerd-" + id + ".scope", id},
+		{"cgroup v2 namespaced", "0::/", ""},
+		{"mountinfo hostname", "645 627 254:1 /var/lib/docker/containers/" + id + "/hostname /etc/hostname rw,relatime - ext4 /dev/vda1 rw", id},
+		{"mountinfo overlay", "627 572 0:52 / / rw,relatime master:279 - overlay overlay rw,lowerdir=/var/lib/docker/overlay2/l/ABC,upperdir=/var/lib/docker/overlay2/" + layer + "/diff", ""},
+		{"bare hash", "5:devices:/user.slice/" + layer, ""},
+	}
+	for _, tt := range tests {
+		if got := matchContainerID(tt.line); got != tt.want {
+			t.Errorf("%s: container id = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadContainerID(t *testing.T) {
+	f, err := ioutil.TempFile("", "mountinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	id := "3f1c0a9d2b7e4c6f8a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f6071"
+	_, _ = f.WriteString("627 572 0:52 / / rw,relatime - overlay overlay rw,upperdir=/var/lib/docker/overlay2/" + strings.Repeat("a", 64) + "/diff\n")
+	_, _ = f.WriteString("645 627 254:1 /var/lib/docker/containers/" + id + "/hostname /etc/hostname rw,relatime - ext4 /dev/vda1 rw\n")
+	_ = f.Close()
+
+	if got := readContainerID("/not/exist", f.Name()); got != id {
+		t.Fatalf("container id = %q", got)
+	}
+}
+
+func TestReleaseLedger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ject-ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/ledger.json"
+
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetDedupWindow(0), SetReleaseLedger(path))
+	cj.AddHook(hook)
+	engine := newPanicEngine(cj)
+	serve(engine, "/nil")
+	serve(engine, "/nil")
+
+	// 同一个版本中再次出现时仍然是这个版本新出现的 panic
+	first, second := hook.entries[0], hook.entries[1]
+	if !first.NewInRelease || !second.NewInRelease || second.FirstSeenRelease != first.Build.Release() {
+		t.Fatalf("unexpected ledger marks first=%v second=%v/%s", first.NewInRelease, second.NewInRelease, second.FirstSeenRelease)
+	}
+
+	// 重启之后版本没有变化
+	restarted := NewInject(SetAsync(false), SetReleaseLedger(path))
+	restarted.AddHook(hook)
+	serve(newPanicEngine(restarted), "/nil")
+	if !hook.entries[2].NewInRelease {
+		t.Fatal("panic first seen in the current release should be new after restart")
+	}
+
+	// 之前的版本中已经出现过的 panic 不是新的
+	data, _ := json.Marshal(map[string]*ledgerRecord{first.Fingerprint: {Release: "v0.9.0", FirstSeen: time.Now()}})
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	upgraded := NewInject(SetAsync(false), SetReleaseLedger(path))
+	upgraded.AddHook(hook)
+	serve(newPanicEngine(upgraded), "/nil")
+	if e := hook.entries[3]; e.NewInRelease || e.FirstSeenRelease != "v0.9.0" {
+		t.Fatalf("panic from an older release marked new=%v first=%s", e.NewInRelease, e.FirstSeenRelease)
+	}
+}
@@ -0,0 +1,65 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 报告的类型
+const (
+	KindPanic  = "panic"  // 程序 panic
+	KindError  = "error"  // 处理函数通过 c.Error() 记录了错误
+	KindStatus = "status" // 响应的状态码在 SetReportStatusCodes 配置的范围内
+	KindStuck  = "stuck"  // 请求的执行时间超过了 WatchdogConfig.Threshold
+)
+
+// 设置需要报告的响应状态码, 比如: SetReportStatusCodes(500, 502, 503), 默认不报告
+func SetReportStatusCodes(codes ...int) InjectOption {
+	return func(c *Inject) {
+		c.reportStatus = make(map[int]struct{}, len(codes))
+		for _, code := range codes {
+			c.reportStatus[code] = struct{}{}
+		}
+	}
+}
+
+// 设置是否报告通过 c.Error() 记录了错误的请求, 默认不报告
+func SetReportGinErrors(enable bool) InjectOption {
+	return func(c *Inject) {
+		c.reportGinErrors = enable
+	}
+}
+
+// 请求正常结束之后, 按照配置报告 c.Errors 不为空或者状态码需要报告的请求, 同一个请求只报告一次
+func (c *Inject) reportFailure(ctx context.Context, gc *gin.Context, start time.Time) {
+	status := gc.Writer.Status()
+	_, badStatus := c.reportStatus[status]
+	hasErrors := c.reportGinErrors && len(gc.Errors) > 0
+	if !badStatus && !hasErrors {
+		return
+	}
+
+	entry := c.ginEntry(ctx, gc, start)("")
+	if hasErrors {
+		entry.Kind = KindError
+		entry.Message = gc.Errors.String()
+		entry.setPanic(gc.Errors.Last().Err)
+		entry.Fingerprint = fingerprint(fmt.Sprintf("%s %s %s %s", KindError, entry.Method, entry.Route, entry.PanicType), nil)
+	} else {
+		entry.Kind = KindStatus
+		entry.Message = fmt.Sprintf("%d %s", status, http.StatusText(status))
+		entry.Fingerprint = fingerprint(fmt.Sprintf("%s %s %s %d", KindStatus, entry.Method, entry.Route, status), nil)
+	}
+	c.attachBreadcrumbs(entry)
+
+	c.dispatch(entry)
+}
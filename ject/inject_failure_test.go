@@ -0,0 +1,52 @@
+package ject
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReportFailures(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetReportStatusCodes(http.StatusBadGateway), SetReportGinErrors(true))
+	cj.AddHook(hook)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(RecoveryHandlerFunc(cj))
+	engine.GET("/ok", func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+	engine.GET("/upstream", func(c *gin.Context) {
+		c.Status(http.StatusBadGateway)
+	})
+	engine.GET("/error", func(c *gin.Context) {
+		_ = c.Error(errors.New("db timeout"))
+		c.Status(http.StatusBadGateway)
+	})
+	engine.GET("/panic", func(c *gin.Context) {
+		_ = c.Error(errors.New("before panic"))
+		panic("boom")
+	})
+
+	for _, path := range []string{"/ok", "/upstream", "/error", "/panic"} {
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if hook.count() != 3 {
+		t.Fatalf("delivered %d entries, want 3", hook.count())
+	}
+	status, failed, panicked := hook.entries[0], hook.entries[1], hook.entries[2]
+	if status.Kind != KindStatus || status.Status != http.StatusBadGateway || status.Route != "/upstream" || status.Message != "502 Bad Gateway" || status.Cause != "" {
+		t.Fatalf("unexpected status entry %+v", status)
+	}
+	if failed.Kind != KindError || failed.PanicValue != "db timeout" || failed.Message != "Error #01: db timeout\n" || failed.Fingerprint == status.Fingerprint {
+		t.Fatalf("unexpected error entry %+v", failed)
+	}
+	if panicked.Kind != KindPanic || panicked.PanicValue != "boom" {
+		t.Fatalf("unexpected panic entry %+v", panicked)
+	}
+}
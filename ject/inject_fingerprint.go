@@ -0,0 +1,127 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	_fingerprintFrames  = 5           // 参与计算指纹的栈帧数量
+	_defaultDedupWindow = time.Minute // 默认的去重窗口
+	_maxDedupStates     = 1024        // 超过该数量时清理过期的指纹
+)
+
+// 设置相同指纹的去重窗口, 窗口内重复的 panic 只计数不投递, 小于等于 0 时关闭去重
+func SetDedupWindow(d time.Duration) InjectOption {
+	return func(c *Inject) {
+		c.dedupWindow = d
+	}
+}
+
+// 根据 panic 的类型和栈顶的业务函数计算指纹, 不包含行号和地址, 代码小改动之后指纹不变
+// 栈中没有业务代码时使用栈顶的函数
+func fingerprint(panicType string, frames []Frame) string {
+	h := sha1.New()
+	_, _ = fmt.Fprintln(h, panicType)
+
+	picked := make([]Frame, 0, _fingerprintFrames)
+	for _, f := range frames {
+		if f.InApp && len(picked) < _fingerprintFrames {
+			picked = append(picked, f)
+		}
+	}
+	if len(picked) == 0 {
+		for _, f := range frames {
+			if len(picked) < _fingerprintFrames && f.Package != "runtime" {
+				picked = append(picked, f)
+			}
+		}
+	}
+
+	for _, f := range picked {
+		_, _ = fmt.Fprintf(h, "%s.%s\n", f.Package, f.Function)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// 单个指纹的去重状态
+type dedupState struct {
+	lastReport time.Time // 上一次投递的时间
+	suppressed int64     // 上一次投递之后被抑制的次数
+}
+
+// 按照指纹去重, 窗口内重复的报告只计数
+type deduper struct {
+	mu     sync.Mutex
+	window time.Duration
+	states map[string]*dedupState
+}
+
+func newDeduper(window time.Duration) *deduper {
+	return &deduper{window: window, states: make(map[string]*dedupState, 16)}
+}
+
+// 判断报告是否需要投递, 需要投递时返回自上一次投递以来的发生次数和经过的时间
+func (d *deduper) allow(fp string, now time.Time) (bool, int64, time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	st, ok := d.states[fp]
+	if !ok {
+		d.sweep(now)
+		d.states[fp] = &dedupState{lastReport: now}
+		return true, 1, 0
+	}
+
+	elapsed := now.Sub(st.lastReport)
+	if elapsed < d.window {
+		st.suppressed++
+		return false, 0, 0
+	}
+
+	count := st.suppressed + 1
+	st.lastReport = now
+	st.suppressed = 0
+	return true, count, elapsed
+}
+
+// 清理过期并且没有未报告次数的指纹, 防止内存无限增长
+func (d *deduper) sweep(now time.Time) {
+	if len(d.states) < _maxDedupStates {
+		return
+	}
+	for fp, st := range d.states {
+		if st.suppressed == 0 && now.Sub(st.lastReport) >= d.window {
+			delete(d.states, fp)
+		}
+	}
+}
+
+// 去重检查, 返回 false 表示报告被抑制
+func (c *Inject) admit(entry *Entry) bool {
+	if c.deduper == nil || entry.Fingerprint == "" {
+		return true
+	}
+
+	ok, count, elapsed := c.deduper.allow(entry.Fingerprint, time.Now())
+	if !ok {
+		_, _ = fmt.Fprintf(os.Stderr, "ject: suppress duplicate panic fingerprint:%s\n", entry.Fingerprint)
+		return false
+	}
+
+	entry.Occurrences = count
+	if elapsed > 0 {
+		entry.OccurrenceWindow = elapsed.Round(time.Second).String()
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package ject
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newPanicEngine(cj *Inject) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(RecoveryHandlerFunc(cj))
+	engine.GET("/nil", func(c *gin.Context) {
+		var ptr *int
+		*ptr = 8086
+	})
+	engine.GET("/index", func(c *gin.Context) {
+		var data = make([]int, 1)
+		idx := len(c.Query("n")) + 1
+		data[idx] = 1
+	})
+	return engine
+}
+
+func serve(engine *gin.Engine, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestFingerprintDedup(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetDedupWindow(time.Hour))
+	cj.AddHook(hook)
+	engine := newPanicEngine(cj)
+
+	for i := 0; i < 3; i++ {
+		serve(engine, "/nil")
+	}
+	serve(engine, "/index")
+
+	if hook.count() != 2 {
+		t.Fatalf("delivered %d entries, want 2", hook.count())
+	}
+	if hook.entries[0].Fingerprint == "" || hook.entries[0].Fingerprint == hook.entries[1].Fingerprint {
+		t.Fatalf("unexpected fingerprints %q %q", hook.entries[0].Fingerprint, hook.entries[1].Fingerprint)
+	}
+}
+
+func TestDeduperCountsSuppressed(t *testing.T) {
+	d := newDeduper(5 * time.Minute)
+	now := time.Now()
+
+	if ok, count, _ := d.allow("fp", now); !ok || count != 1 {
+		t.Fatalf("first report ok=%v count=%d", ok, count)
+	}
+	for i := 1; i <= 346; i++ {
+		if ok, _, _ := d.allow("fp", now.Add(time.Duration(i)*time.Millisecond)); ok {
+			t.Fatal("duplicate inside window should be suppressed")
+		}
+	}
+
+	ok, count, elapsed := d.allow("fp", now.Add(5*time.Minute))
+	if !ok || count != 347 || elapsed != 5*time.Minute {
+		t.Fatalf("next report ok=%v count=%d elapsed=%s", ok, count, elapsed)
+	}
+}
@@ -0,0 +1,105 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+const _goroutineMethod = "GOROUTINE" // 协程 panic 在报告中的请求方法
+
+// PanicError 协程中的 panic 转换成的错误
+type PanicError struct {
+	Value interface{} // panic 的值
+	Entry *Entry      // 投递给钩子的报告
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("ject: goroutine %s panic: %v", e.Entry.Goroutine, e.Value)
+}
+
+// Unwrap panic 的值是 error 时返回该错误
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Go 启动一个协程, 协程中的 panic 会被拦截并投递给钩子, 不会导致进程退出
+// name 是协程的逻辑名称, 会记录在报告中
+func Go(ctx context.Context, cj *Inject, name string, fn func(ctx context.Context)) {
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				cj.capture(rec, cj.goroutineEntry(ctx, name))
+			}
+		}()
+		fn(ctx)
+	}()
+}
+
+// 构造协程 panic 的报告, 请求 ID 取自父协程的上下文
+func (c *Inject) goroutineEntry(ctx context.Context, name string) func(string) *Entry {
+	return func(cause string) *Entry {
+		entry := c.NewEntry(ctx, nil, cause)
+		entry.Method = _goroutineMethod
+		entry.Goroutine = name
+		return entry
+	}
+}
+
+// Group 与 errgroup 类似, 任意一个协程返回错误或者 panic 时取消上下文
+// 协程中的 panic 会被拦截并投递给钩子, Wait 返回 *PanicError
+type Group struct {
+	cj     *Inject
+	ctx    context.Context
+	cancel func()
+
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+}
+
+// WithGroup 构造协程组, 返回的上下文在第一个协程失败或者 Wait 返回时取消
+func WithGroup(ctx context.Context, cj *Inject) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{cj: cj, ctx: ctx, cancel: cancel}, ctx
+}
+
+// Go 在协程组中启动一个协程, name 是协程的逻辑名称
+func (g *Group) Go(name string, fn func(ctx context.Context) error) {
+	g.wg.Add(1)
+
+	go func() {
+		defer g.wg.Done()
+
+		if err := g.run(name, fn); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				g.cancel()
+			})
+		}
+	}()
+}
+
+// 执行协程函数, panic 转换成 *PanicError
+func (g *Group) run(name string, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			entry := g.cj.capture(rec, g.cj.goroutineEntry(g.ctx, name))
+			err = &PanicError{Value: rec, Entry: entry}
+		}
+	}()
+	return fn(g.ctx)
+}
+
+// Wait 等待所有协程结束, 返回第一个错误
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
@@ -0,0 +1,64 @@
+package ject
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/laxiaohong/agave/reqid"
+)
+
+func TestGoRecoversPanic(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false))
+	cj.AddHook(hook)
+
+	done := make(chan struct{})
+	ctx := reqid.NewContext(context.Background(), "parent-1")
+	Go(ctx, cj, "send-mail", func(ctx context.Context) {
+		defer close(done)
+		panic("smtp down")
+	})
+	<-done
+	// fn 的 defer 先于拦截器执行, 等待报告投递完成
+	for i := 0; i < 100 && hook.count() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if hook.count() != 1 {
+		t.Fatalf("delivered %d entries", hook.count())
+	}
+	if e := hook.entries[0]; e.Goroutine != "send-mail" || e.RequestID != "parent-1" || e.PanicValue != "smtp down" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+}
+
+func TestGroupSurfacesPanic(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false))
+	cj.AddHook(hook)
+
+	g, ctx := WithGroup(context.Background(), cj)
+	g.Go("loader", func(ctx context.Context) error {
+		var m map[string]int
+		m["boom"]++
+		return nil
+	})
+	g.Go("waiter", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	err := g.Wait()
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Entry.Goroutine != "loader" {
+		t.Fatalf("Wait() = %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("group context should be canceled")
+	}
+	if hook.count() != 1 {
+		t.Fatalf("delivered %d entries", hook.count())
+	}
+}
@@ -0,0 +1,125 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const _grpcMethod = "GRPC" // gRPC 请求在报告中的请求方法
+
+// UnaryServerInterceptor gRPC 一元调用的崩溃拦截器, panic 之后返回 codes.Internal
+func UnaryServerInterceptor(cj *Inject) grpc.UnaryServerInterceptor {
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		ctx = cj.breadcrumbContext(ctx)
+		defer func() {
+			if rec := recover(); rec != nil {
+				cj.recoverPanic(rec, cj.grpcEntry(ctx, info.FullMethod, req))
+				err = status.Error(codes.Internal, "internal server error")
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor gRPC 流式调用的崩溃拦截器, panic 之后返回 codes.Internal
+func StreamServerInterceptor(cj *Inject) grpc.StreamServerInterceptor {
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx := cj.breadcrumbContext(ss.Context())
+		if ctx != ss.Context() {
+			ss = &serverStream{ServerStream: ss, ctx: ctx}
+		}
+		defer func() {
+			if rec := recover(); rec != nil {
+				cj.recoverPanic(rec, cj.grpcEntry(ctx, info.FullMethod, nil))
+				err = status.Error(codes.Internal, "internal server error")
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// serverStream 替换流的上下文, 业务代码通过 ss.Context() 打印日志时才能被记录到面包屑
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// 构造 gRPC 请求的报告, 请求内容由 metadata 和请求消息组成
+func (c *Inject) grpcEntry(ctx context.Context, method string, req interface{}) func(string) *Entry {
+	return func(cause string) *Entry {
+		md, _ := metadata.FromIncomingContext(ctx)
+
+		entry := c.NewEntry(ctx, nil, cause)
+		entry.RequestURI = method
+		entry.Method = _grpcMethod
+		if ids := md.Get(requestID); len(ids) > 0 && entry.RequestID == "" {
+			entry.RequestID = ids[0]
+		}
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			entry.RemoteAddr = p.Addr.String()
+		}
+		entry.RequestContent = c.PurgeRequest(c.redactor.dumpGRPCRequest(method, md, req))
+
+		return entry
+	}
+}
+
+// 把 gRPC 请求格式化成文本, 格式与 httputil.DumpRequest 类似, 同时按照规则过滤敏感数据
+func (r *Redactor) dumpGRPCRequest(method string, md metadata.MD, req interface{}) string {
+	header := make(http.Header, len(md))
+	for k, v := range md {
+		header[k] = append([]string(nil), v...)
+	}
+
+	var body []byte
+	switch msg := req.(type) {
+	case nil:
+	case proto.Message:
+		data, err := protojson.Marshal(msg)
+		if err != nil {
+			data = []byte(fmt.Sprintf("%v", msg))
+		}
+		body = data
+	default:
+		body = []byte(fmt.Sprintf("%v", msg))
+	}
+
+	if r != nil {
+		r.redactHeader(header)
+		if len(r.BodyFields) > 0 {
+			body = r.redactJSON(body)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%s %s\r\n", _grpcMethod, method)
+	buf.WriteString(formatHeader(header))
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	if r == nil {
+		return buf.String()
+	}
+	return r.detect(buf.String())
+}
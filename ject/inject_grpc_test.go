@@ -0,0 +1,84 @@
+package ject
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/laxiaohong/agave/crumb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type panicHealthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+}
+
+func (panicHealthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	var data []int
+	_ = data[len(req.Service)]
+	return nil, nil
+}
+
+func (panicHealthServer) Watch(req *grpc_health_v1.HealthCheckRequest, ss grpc_health_v1.Health_WatchServer) error {
+	crumb.Record(ss.Context(), crumb.Crumb{Category: crumb.CategoryLog, Message: "watching"})
+	panic("watch is broken")
+}
+
+func TestGRPCInterceptors(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetBreadcrumbs(4))
+	cj.AddHook(hook)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(cj)),
+		grpc.StreamInterceptor(StreamServerInterceptor(cj)),
+	)
+	grpc_health_v1.RegisterHealthServer(srv, panicHealthServer{})
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-trace-id", "grpc-trace")
+	_, err = client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "agave"})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("Check err = %v", err)
+	}
+
+	stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.Recv(); status.Code(err) != codes.Internal {
+		t.Fatalf("Watch err = %v", err)
+	}
+
+	if hook.count() != 2 {
+		t.Fatalf("delivered %d entries, want 2", hook.count())
+	}
+	unary := hook.entries[0]
+	if unary.RequestURI != "/grpc.health.v1.Health/Check" || unary.RequestID != "grpc-trace" || unary.RemoteAddr == "" {
+		t.Fatalf("unexpected unary entry %+v", unary)
+	}
+	if !strings.Contains(unary.RequestContent, `"agave"`) || !strings.Contains(unary.RequestContent, "x-trace-id: grpc-trace") {
+		t.Fatalf("unexpected request content %q", unary.RequestContent)
+	}
+	if stream := hook.entries[1]; stream.PanicValue != "watch is broken" || len(stream.Breadcrumbs) != 1 || stream.Breadcrumbs[0].Message != "watching" {
+		t.Fatalf("unexpected stream entry %+v", hook.entries[1])
+	}
+}
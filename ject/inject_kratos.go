@@ -0,0 +1,53 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	kgrpc "github.com/go-kratos/kratos/v2/transport/grpc"
+	khttp "github.com/go-kratos/kratos/v2/transport/http"
+)
+
+const _kratosReason = "RECOVERY" // kratos 错误的 reason
+
+// KratosMiddleware kratos HTTP 和 gRPC 服务的崩溃拦截器, panic 之后返回 kratos 的 500 错误
+func KratosMiddleware(cj *Inject) middleware.Middleware {
+
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			ctx = cj.breadcrumbContext(ctx)
+			defer func() {
+				if rec := recover(); rec != nil {
+					cj.recoverPanic(rec, cj.kratosEntry(ctx, req))
+					err = errors.InternalServer(_kratosReason, "internal server error")
+				}
+			}()
+			return handler(ctx, req)
+		}
+	}
+}
+
+// 根据 kratos 的 transport 信息构造报告
+func (c *Inject) kratosEntry(ctx context.Context, req interface{}) func(string) *Entry {
+	if info, ok := khttp.FromServerContext(ctx); ok && info.Request != nil {
+		return c.httpEntry(ctx, info.Request)
+	}
+	if info, ok := kgrpc.FromServerContext(ctx); ok {
+		return c.grpcEntry(ctx, info.FullMethod, req)
+	}
+
+	return func(cause string) *Entry {
+		entry := c.NewEntry(ctx, nil, cause)
+		if tr, ok := transport.FromContext(ctx); ok {
+			entry.Method = string(tr.Kind)
+		}
+		return entry
+	}
+}
@@ -0,0 +1,44 @@
+package ject
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	kgrpc "github.com/go-kratos/kratos/v2/transport/grpc"
+	khttp "github.com/go-kratos/kratos/v2/transport/http"
+)
+
+func TestKratosMiddleware(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetDedupWindow(0))
+	cj.AddHook(hook)
+
+	handler := KratosMiddleware(cj)(func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("kratos handler panic")
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/greeter/agave", nil)
+	r.Header.Set(requestID, "kratos-http")
+	ctx := khttp.NewServerContext(context.Background(), khttp.ServerInfo{Request: r, Response: httptest.NewRecorder()})
+	if _, err := handler(ctx, nil); !errors.IsInternalServer(err) {
+		t.Fatalf("http err = %v", err)
+	}
+
+	ctx = kgrpc.NewServerContext(context.Background(), kgrpc.ServerInfo{FullMethod: "/helloworld.Greeter/SayHello"})
+	if _, err := handler(ctx, nil); !errors.IsInternalServer(err) {
+		t.Fatalf("grpc err = %v", err)
+	}
+
+	if hook.count() != 2 {
+		t.Fatalf("delivered %d entries, want 2", hook.count())
+	}
+	if e := hook.entries[0]; e.RequestURI != "/v1/greeter/agave" || e.RequestID != "kratos-http" {
+		t.Fatalf("unexpected http entry %+v", e)
+	}
+	if e := hook.entries[1]; e.RequestURI != "/helloworld.Greeter/SayHello" || e.Method != _grpcMethod {
+		t.Fatalf("unexpected grpc entry %+v", e)
+	}
+}
@@ -0,0 +1,198 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	_defaultProfileMaxBytes    = 32 << 20    // 单个文件默认最大 32MB
+	_defaultProfileMaxCaptures = 10          // 默认最多保留 10 次快照
+	_defaultProfileInterval    = time.Minute // 默认两次快照至少间隔 1 分钟
+
+	_profileDirLayout = "20060102T150405.000000000" // 快照目录名中的时间格式
+)
+
+var errProfileTooLarge = errors.New("ject: profile exceeds size limit")
+
+// 快照目录名: <时间>-<指纹>, 清理时只处理这样的目录
+var profileDirPattern = regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}-[0-9A-Za-z]*$`)
+
+// ProfileConfig panic 时采集协程和内存快照的配置
+type ProfileConfig struct {
+	Dir         string        // 快照保存的目录, 每次快照一个子目录, 为空时不采集
+	MaxBytes    int64         // 单个文件的最大字节数, 协程栈超过时截断, profile 超过时丢弃
+	MaxCaptures int           // 最多保留的快照数量, 超过时删除最老的快照
+	MinInterval time.Duration // 两次快照的最小间隔, 防止高负载时被反复触发
+}
+
+// 设置 panic 时采集所有协程的栈, 堆和协程 profile
+// 清理旧快照时会删除目录, 所以 Dir 为空时不采集, 避免在工作目录中写入和删除
+func SetProfileCapture(cfg ProfileConfig) InjectOption {
+	return func(c *Inject) {
+		if cfg.Dir == "" {
+			_, _ = fmt.Fprintln(os.Stderr, "ject: profile capture disabled, dir is empty")
+			c.profile = nil
+			return
+		}
+		if cfg.MaxBytes <= 0 {
+			cfg.MaxBytes = _defaultProfileMaxBytes
+		}
+		if cfg.MaxCaptures <= 0 {
+			cfg.MaxCaptures = _defaultProfileMaxCaptures
+		}
+		if cfg.MinInterval <= 0 {
+			cfg.MinInterval = _defaultProfileInterval
+		}
+		c.profile = &profiler{cfg: cfg}
+	}
+}
+
+// profiler 按照频率限制采集快照
+type profiler struct {
+	mu   sync.Mutex
+	cfg  ProfileConfig
+	last time.Time
+}
+
+// 采集快照, 返回文件名到路径的映射, 被频率限制时返回 nil
+func (p *profiler) capture(fp string) (map[string]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if !p.last.IsZero() && now.Sub(p.last) < p.cfg.MinInterval {
+		return nil, nil
+	}
+	p.last = now
+
+	dir := filepath.Join(p.cfg.Dir, fmt.Sprintf("%s-%s", now.Format(_profileDirLayout), fp))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string, 3)
+	var errs []string
+
+	name := filepath.Join(dir, "goroutines.txt")
+	if err := ioutil.WriteFile(name, allStacks(p.cfg.MaxBytes), 0644); err != nil {
+		errs = append(errs, err.Error())
+	} else {
+		files["goroutines"] = name
+	}
+
+	for _, profile := range []string{"heap", "goroutine"} {
+		name = filepath.Join(dir, profile+".pprof")
+		if err := writeProfile(name, profile, p.cfg.MaxBytes); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		files[profile] = name
+	}
+
+	p.prune()
+
+	if len(errs) > 0 {
+		return files, fmt.Errorf("%v", errs)
+	}
+	return files, nil
+}
+
+// 所有协程的栈, 超过上限时截断
+func allStacks(limit int64) []byte {
+	size := int64(1 << 20)
+	for {
+		if size > limit {
+			size = limit
+		}
+		buf := make([]byte, size)
+		n := runtime.Stack(buf, true)
+		if int64(n) < size || size == limit {
+			return buf[:n]
+		}
+		size *= 2
+	}
+}
+
+// 写入 profile, 超过上限时删除文件
+func writeProfile(name, profile string, limit int64) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	err = pprof.Lookup(profile).WriteTo(&limitWriter{w: f, remain: limit}, 0)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(name)
+	}
+	return err
+}
+
+// 删除超过数量的最老的快照, 目录中的其他文件和目录不受影响
+func (p *profiler) prune() {
+	infos, err := ioutil.ReadDir(p.cfg.Dir)
+	if err != nil {
+		return
+	}
+
+	dirs := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() && profileDirPattern.MatchString(info.Name()) {
+			dirs = append(dirs, info.Name())
+		}
+	}
+	// 目录名以时间开头, 按名字排序就是按时间排序
+	sort.Strings(dirs)
+	for len(dirs) > p.cfg.MaxCaptures {
+		_ = os.RemoveAll(filepath.Join(p.cfg.Dir, dirs[0]))
+		dirs = dirs[1:]
+	}
+}
+
+// limitWriter 超过上限时返回错误
+type limitWriter struct {
+	w      io.Writer
+	remain int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.remain {
+		return 0, errProfileTooLarge
+	}
+	n, err := l.w.Write(p)
+	l.remain -= int64(n)
+	return n, err
+}
+
+// 采集快照并把路径写入报告
+func (c *Inject) captureProfiles(entry *Entry) {
+	if c.profile == nil {
+		return
+	}
+
+	files, err := c.profile.capture(entry.Fingerprint)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "ject: profile capture err:%s\n", err)
+	}
+	if len(files) > 0 {
+		entry.Data["profiles"] = files
+	}
+}
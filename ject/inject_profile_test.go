@@ -0,0 +1,81 @@
+package ject
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ject-profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetDedupWindow(0), SetProfileCapture(ProfileConfig{Dir: dir, MinInterval: time.Hour}))
+	cj.AddHook(hook)
+	engine := newPanicEngine(cj)
+	serve(engine, "/nil")
+	serve(engine, "/nil")
+
+	files, ok := hook.entries[0].Data["profiles"].(map[string]string)
+	if !ok || len(files) != 3 {
+		t.Fatalf("unexpected profiles %v", hook.entries[0].Data)
+	}
+	data, err := ioutil.ReadFile(files["goroutines"])
+	if err != nil || !strings.Contains(string(data), "goroutine ") {
+		t.Fatalf("goroutine dump err=%v", err)
+	}
+	if _, ok = hook.entries[1].Data["profiles"]; ok {
+		t.Fatal("second capture should be rate limited")
+	}
+}
+
+func TestProfilePrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ject-profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 与快照无关的目录和文件不会被清理
+	for _, name := range []string{"data", "20210423T000000.000000000"} {
+		if err = os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := &profiler{cfg: ProfileConfig{Dir: dir, MaxBytes: 1 << 20, MaxCaptures: 2, MinInterval: time.Nanosecond}}
+	for i := 0; i < 4; i++ {
+		if _, err = p.capture("fp"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	infos, _ := ioutil.ReadDir(dir)
+	captures := 0
+	for _, info := range infos {
+		if profileDirPattern.MatchString(info.Name()) {
+			captures++
+		}
+	}
+	if len(infos) != 4 || captures != 2 {
+		t.Fatalf("kept %d entries with %d captures, want 4 and 2", len(infos), captures)
+	}
+
+	if got := allStacks(64); len(got) != 64 {
+		t.Fatalf("stack dump should be truncated to 64 bytes, got %d", len(got))
+	}
+}
+
+func TestProfileCaptureRequiresDir(t *testing.T) {
+	cj := NewInject(SetProfileCapture(ProfileConfig{}))
+	if cj.profile != nil {
+		t.Fatal("profile capture should be disabled without dir")
+	}
+}
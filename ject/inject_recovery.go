@@ -6,139 +6,138 @@
 package ject
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"io/ioutil"
+	"github.com/laxiaohong/agave/reqid"
 	"net"
 	"net/http"
-	"net/http/httputil"
 	"os"
-	"runtime"
 	"strings"
-)
-
-var (
-	dunno     = []byte("???")
-	centerDot = []byte("·")
-	dot       = []byte(".")
-	slash     = []byte("/")
+	"time"
 )
 
 func RecoveryHandlerFunc(cj *Inject) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
-		ctx := context.WithValue(context.TODO(), requestID, c.Request.Header.Get(requestID))
+		start := time.Now()
+		c.Request = cj.trackBreadcrumbs(cj.captureBody(c.Request))
+		ctx := cj.requestContext(c.Request)
+		c.Request = c.Request.WithContext(ctx)
 		defer func() {
 			if err := recover(); err != nil {
-				// Check for a broken connection, as it is not really a
-				// condition that warrants a panic stack trace.
-				var brokenPipe bool
-				if ne, ok := err.(*net.OpError); ok {
-					if se, ok := ne.Err.(*os.SyscallError); ok {
-						if strings.Contains(strings.ToLower(se.Error()), "broken pipe") || strings.Contains(strings.ToLower(se.Error()), "connection reset by peer") {
-							brokenPipe = true
-						}
-					}
-				}
-
-				stack := stack(3)
-				httpRequest, _ := httputil.DumpRequest(c.Request, true)
-				headers := strings.Split(string(httpRequest), "\r\n")
-				for idx, header := range headers {
-					current := strings.Split(header, ":")
-					if current[0] == "Authorization" {
-						headers[idx] = current[0] + ": *"
+				// If the connection is dead, we can't write a status to it.
+				entry, brokenPipe := cj.recoverPanic(err, cj.ginEntry(ctx, c, start))
+				if brokenPipe {
+					if e, ok := err.(error); ok {
+						c.Error(e) // nolint: errcheck
 					}
+				} else if !c.Writer.Written() {
+					cj.respond(c.Writer, c.Request, entry)
 				}
+				c.Abort()
+			}
+		}()
+		c.Next()
+		cj.reportFailure(ctx, c, start)
+	}
+}
 
-				entry := cj.NewEntry(ctx, c.Request, string(stack))
+// RecoveryHandler net/http 版本的崩溃拦截器, 与 RecoveryHandlerFunc 的行为一致
+func RecoveryHandler(cj *Inject, next http.Handler) http.Handler {
 
-				for _, v := range cj.Hooks {
-					err = v.Fire(entry.Ctx, entry)
-					if err != nil {
-						_, _ = fmt.Fprintf(os.Stderr, "err:%s", err)
-					}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := newResponseWriter(w)
+		r = cj.trackBreadcrumbs(cj.captureBody(r))
+		ctx := cj.requestContext(r)
+		r = r.WithContext(ctx)
+		defer func() {
+			if err := recover(); err != nil {
+				// http.ErrAbortHandler 是用户主动中断请求, 交给 net/http 处理
+				if err == http.ErrAbortHandler {
+					panic(err)
 				}
-				_, _ = fmt.Fprintf(os.Stderr, "panic:%s", string(stack))
-
-				if cj.ThrowPanic {
-					panic(string(stack))
-				} else {
-					// If the connection is dead, we can't write a status to it.
-					if brokenPipe {
-						c.Error(err.(error)) // nolint: errcheck
-						c.Abort()
-					} else {
-						c.AbortWithStatus(http.StatusInternalServerError)
-					}
+				// If the connection is dead, we can't write a status to it.
+				entry, brokenPipe := cj.recoverPanic(err, cj.responseEntry(ctx, r, rw, start))
+				if !brokenPipe && !rw.written() {
+					cj.respond(rw, r, entry)
 				}
-
 			}
-
 		}()
-		c.Next()
-	}
+		next.ServeHTTP(rw.wrap(), r)
+	})
 }
 
-// stack returns a nicely formatted stack frame, skipping skip frames.
-func stack(skip int) []byte {
-	buf := new(bytes.Buffer) // the returned data
-	// As we loop, we open files and read them. These variables record the currently
-	// loaded file.
-	var lines [][]byte
-	var lastFile string
-	for i := skip; ; i++ { // Skip the expected number of frames
-		pc, file, line, ok := runtime.Caller(i)
-		if !ok {
-			break
-		}
-		// Print this much at least.  If we can't find the source, it won't show.
-		fmt.Fprintf(buf, "%s:%d (0x%x)\n", file, line, pc)
-		if file != lastFile {
-			data, err := ioutil.ReadFile(file)
-			if err != nil {
-				continue
-			}
-			lines = bytes.Split(data, []byte{'\n'})
-			lastFile = file
-		}
-		fmt.Fprintf(buf, "\t%s: %s\n", function(pc), source(lines, line))
+// 构造报告使用的上下文, 保留请求上下文中的 span, 请求没有携带请求 ID 时生成一个
+// 拦截器会把这个上下文设置回请求, 后续的中间件和业务代码可以通过 reqid.FromContext 拿到同一个请求 ID
+func (c *Inject) requestContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if reqid.FromContext(ctx) != "" {
+		return ctx
 	}
-	return buf.Bytes()
+
+	id := c.GetRequestID(r)
+	if id == "" {
+		id = reqid.NewULID()
+	}
+	return reqid.NewContext(ctx, id)
 }
 
-// source returns a space-trimmed slice of the n'th line.
-func source(lines [][]byte, n int) []byte {
-	n-- // in stack trace, lines are 1-indexed but our array is 0-indexed
-	if n < 0 || n >= len(lines) {
-		return dunno
+// recoverPanic 是各个拦截器共用的处理逻辑: 构造报告, 投递钩子, 按照配置继续抛出异常
+// build 根据文本格式的调用栈构造报告, 由各个拦截器填充请求相关的信息
+// 返回本次的报告, brokenPipe 为 true 表示客户端连接已经断开, 不需要再写响应
+func (c *Inject) recoverPanic(err interface{}, build func(cause string) *Entry) (entry *Entry, brokenPipe bool) {
+	brokenPipe = isBrokenPipe(err)
+
+	entry = c.capture(err, build)
+	if c.ThrowPanic {
+		panic(entry.Cause)
 	}
-	return bytes.TrimSpace(lines[n])
+
+	return entry, brokenPipe
 }
 
-// function returns, if possible, the name of the function containing the PC.
-func function(pc uintptr) []byte {
-	fn := runtime.FuncForPC(pc)
-	if fn == nil {
-		return dunno
+// capture 构造 panic 的报告并投递给钩子, 必须在 recover 所在的 defer 中调用
+func (c *Inject) capture(err interface{}, build func(cause string) *Entry) *Entry {
+	frames := c.frames(panicCallers())
+	stack := renderStack(frames, c.collapseFrames)
+
+	entry := build(string(stack))
+	entry.Kind = KindPanic
+	entry.Frames = frames
+	entry.setPanic(err)
+	entry.Fingerprint = fingerprint(entry.PanicType, frames)
+	c.recordSpan(entry)
+	c.attachBreadcrumbs(entry)
+	c.markRelease(entry)
+	c.captureProfiles(entry)
+	if c.runtimeSnapshot {
+		entry.Runtime = c.snapshot()
 	}
-	name := []byte(fn.Name())
-	// The name includes the path name to the package, which is unnecessary
-	// since the file name is already included.  Plus, it has center dots.
-	// That is, we see
-	//	runtime/debug.*T·ptrmethod
-	// and want
-	//	*T.ptrmethod
-	// Also the package path might contains dot (e.g. code.google.com/...),
-	// so first eliminate the path prefix
-	if lastSlash := bytes.LastIndex(name, slash); lastSlash >= 0 {
-		name = name[lastSlash+1:]
+
+	c.dispatch(entry)
+	_, _ = fmt.Fprintf(os.Stderr, "panic:%s", string(stack))
+
+	return entry
+}
+
+// 构造 HTTP 请求的报告
+func (c *Inject) httpEntry(ctx context.Context, r *http.Request) func(string) *Entry {
+	return func(cause string) *Entry {
+		return c.NewEntry(ctx, r, cause)
 	}
-	if period := bytes.Index(name, dot); period >= 0 {
-		name = name[period+1:]
+}
+
+// Check for a broken connection, as it is not really a
+// condition that warrants a panic stack trace.
+func isBrokenPipe(err interface{}) bool {
+	if ne, ok := err.(*net.OpError); ok {
+		if se, ok := ne.Err.(*os.SyscallError); ok {
+			if strings.Contains(strings.ToLower(se.Error()), "broken pipe") || strings.Contains(strings.ToLower(se.Error()), "connection reset by peer") {
+				return true
+			}
+		}
 	}
-	name = bytes.Replace(name, centerDot, dot, -1)
-	return name
+	return false
 }
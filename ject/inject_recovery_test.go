@@ -0,0 +1,198 @@
+package ject
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRecoveryHandler(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false))
+	cj.AddHook(hook)
+
+	handler := RecoveryHandler(cj, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]interface{}
+		m["write_invalid_map"] = "panic"
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/write/invalid/map", nil)
+	r.Header.Set(requestID, "trace-1")
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if e := hook.entries[0]; e.Written || e.Size != -1 {
+		t.Fatalf("nothing should be written before the panic, got %+v", e)
+	}
+	if hook.count() != 1 {
+		t.Fatalf("delivered %d entries", hook.count())
+	}
+	entry := hook.entries[0]
+	if entry.RequestID != "trace-1" || entry.Method != http.MethodPost || entry.PanicValue != "assignment to entry in nil map" {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	frames := entry.Frames
+	for len(frames) > 0 && frames[0].Package == "runtime" {
+		frames = frames[1:]
+	}
+	if frames[0].Function != "TestRecoveryHandler.func1" {
+		t.Fatalf("stack should start at the panicking function, got %s", frames[0].Function)
+	}
+}
+
+func TestRecoveryHandlerAbort(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false))
+	cj.AddHook(hook)
+
+	handler := RecoveryHandler(cj, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Fatalf("recover() = %v", err)
+		}
+		if hook.count() != 0 {
+			t.Fatal("aborted request should not be reported")
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestGinEntryResponseContext(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetGinEnricher(func(c *gin.Context, entry *Entry) {
+		entry.Data["tenant"] = c.GetString("tenant")
+	}))
+	cj.AddHook(hook)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(RecoveryHandlerFunc(cj))
+	engine.GET("/user/:id", func(c *gin.Context) {
+		c.Set("tenant", "agave")
+		c.String(http.StatusAccepted, "partial")
+		panic("after write")
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/user/42", nil)
+	r.Header.Set("User-Agent", "ject-test")
+	engine.ServeHTTP(httptest.NewRecorder(), r)
+
+	e := hook.entries[0]
+	if e.Route != "/user/:id" || !strings.Contains(e.Handler, "TestGinEntryResponseContext") {
+		t.Fatalf("unexpected route %q handler %q", e.Route, e.Handler)
+	}
+	if !e.Written || e.Status != http.StatusAccepted || e.Size != len("partial") || e.Elapsed == "" {
+		t.Fatalf("unexpected response context %+v", e)
+	}
+	if e.ClientIP != "192.0.2.1" || e.UserAgent != "ject-test" || e.Data["tenant"] != "agave" {
+		t.Fatalf("unexpected client context ip=%q ua=%q data=%v", e.ClientIP, e.UserAgent, e.Data)
+	}
+}
+
+func TestClientIPTrustedProxies(t *testing.T) {
+	untrusted := NewInject()
+	trusted := NewInject(SetTrustedProxies("10.0.0.0/8", "127.0.0.1", "bad-proxy"))
+
+	tests := []struct {
+		name      string
+		cj        *Inject
+		remote    string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{"no proxy configured", untrusted, "203.0.113.9:1234", "198.51.100.1", "198.51.100.2", "203.0.113.9"},
+		{"untrusted peer", trusted, "203.0.113.9:1234", "198.51.100.1", "", "203.0.113.9"},
+		{"trusted peer", trusted, "10.0.0.2:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"spoofed left hop", trusted, "10.0.0.2:1234", "6.6.6.6, 198.51.100.1, 10.0.0.3", "", "198.51.100.1"},
+		{"all hops trusted", trusted, "127.0.0.1:1234", "10.0.0.4, 10.0.0.3", "", "10.0.0.4"},
+		{"real ip", trusted, "127.0.0.1:1234", "", "198.51.100.2", "198.51.100.2"},
+		{"no headers", trusted, "127.0.0.1:1234", "", "", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-Ip", tt.realIP)
+		}
+		if got := tt.cj.clientIP(r); got != tt.want {
+			t.Errorf("%s: client ip = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if len(trusted.trustedProxies) != 2 {
+		t.Fatalf("trusted proxies = %v", trusted.trustedProxies)
+	}
+}
+
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (w *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	w.pushed = append(w.pushed, target)
+	return nil
+}
+
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (w *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+func TestRecoveryHandlerWriterInterfaces(t *testing.T) {
+	cj := NewInject(SetAsync(false))
+
+	var pusher, readerFrom bool
+	handler := RecoveryHandler(cj, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p http.Pusher
+		p, pusher = w.(http.Pusher)
+		if pusher {
+			_ = p.Push("/app.js", nil)
+		}
+		var rf io.ReaderFrom
+		rf, readerFrom = w.(io.ReaderFrom)
+		if readerFrom {
+			_, _ = rf.ReadFrom(strings.NewReader("hello"))
+		}
+	}))
+
+	for _, tc := range []struct {
+		name                   string
+		w                      http.ResponseWriter
+		wantPush, wantReadFrom bool
+	}{
+		{"plain", httptest.NewRecorder(), false, false},
+		{"pusher", &pushRecorder{ResponseRecorder: httptest.NewRecorder()}, true, false},
+		{"reader from", &readerFromRecorder{httptest.NewRecorder()}, false, true},
+		{"both", &struct {
+			*pushRecorder
+			io.ReaderFrom
+		}{&pushRecorder{ResponseRecorder: httptest.NewRecorder()}, &readerFromRecorder{httptest.NewRecorder()}}, true, true},
+	} {
+		handler.ServeHTTP(tc.w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if pusher != tc.wantPush || readerFrom != tc.wantReadFrom {
+			t.Errorf("%s: pusher=%v readerFrom=%v", tc.name, pusher, readerFrom)
+		}
+	}
+
+	rw := newResponseWriter(&readerFromRecorder{httptest.NewRecorder()})
+	if n, err := rw.wrap().(io.ReaderFrom).ReadFrom(strings.NewReader("hello")); n != 5 || err != nil || rw.size != 5 || rw.status != http.StatusOK {
+		t.Fatalf("ReadFrom n=%d err=%v size=%d status=%d", n, err, rw.size, rw.status)
+	}
+}
@@ -0,0 +1,391 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/laxiaohong/agave/encoding/json"
+)
+
+const _defaultMask = "******" // 默认的屏蔽文本
+
+// Detector 通过正则识别敏感数据, 比如手机号, 身份证号
+type Detector struct {
+	Name    string                    // 名称
+	Pattern *regexp.Regexp            // 匹配的正则
+	Valid   func(match string) bool   // 可选, 对匹配结果做二次校验, 减少误判
+	Mask    func(match string) string // 可选, 替换匹配结果, 为空时使用 Redactor.Mask
+}
+
+// Redactor 声明式的敏感数据过滤规则, 在钩子拿到报告之前执行, 开始使用之后不要再修改
+type Redactor struct {
+	Headers     []string    // 需要屏蔽的请求头, 不区分大小写
+	Cookies     []string    // 需要屏蔽的 cookie, 为空时屏蔽所有 cookie 的值
+	QueryParams []string    // 需要屏蔽的 query 参数, 不区分大小写
+	BodyFields  []string    // 需要屏蔽的 JSON/表单字段, 不带点号时匹配任意层级的同名字段, 带点号时匹配完整路径, 比如: user.password
+	Detectors   []*Detector // 正则检测, 作用于整个请求内容
+	Mask        string      // 屏蔽之后的文本
+
+	once sync.Once      // 第一次使用时编译 text
+	text *regexp.Regexp // 文本中 key=value 形式的敏感字段
+}
+
+// 设置敏感数据过滤规则, nil 表示不过滤
+func SetRedactor(r *Redactor) InjectOption {
+	return func(c *Inject) {
+		c.redactor = r
+	}
+}
+
+// DefaultRedactor 默认的过滤规则, 屏蔽常见的认证信息, 密码, 手机号, 身份证号和银行卡号
+func DefaultRedactor() *Redactor {
+	return &Redactor{
+		Headers:     []string{"Authorization", "Proxy-Authorization", "Set-Cookie", "X-Api-Key", "X-Auth-Token", "X-Access-Token"},
+		QueryParams: []string{"token", "access_token", "refresh_token", "password", "passwd", "secret", "sign", "signature"},
+		BodyFields:  []string{"password", "passwd", "pwd", "token", "access_token", "refresh_token", "secret", "pay_password"},
+		Detectors:   []*Detector{IDCardDetector(), BankCardDetector(), PhoneDetector()},
+		Mask:        _defaultMask,
+	}
+}
+
+// PhoneDetector 中国大陆手机号, 保留前三位和后四位
+func PhoneDetector() *Detector {
+	return &Detector{
+		Name:    "phone",
+		Pattern: regexp.MustCompile(`\b1[3-9]\d{9}\b`),
+		Mask:    keepEnds(3, 4),
+	}
+}
+
+// IDCardDetector 18 位居民身份证号, 保留前三位和后四位
+func IDCardDetector() *Detector {
+	return &Detector{
+		Name:    "id_card",
+		Pattern: regexp.MustCompile(`\b[1-9]\d{5}(?:19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`),
+		Mask:    keepEnds(3, 4),
+	}
+}
+
+// BankCardDetector 16 到 19 位银行卡号, 通过 Luhn 校验减少误判, 保留后四位
+func BankCardDetector() *Detector {
+	return &Detector{
+		Name:    "bank_card",
+		Pattern: regexp.MustCompile(`\b\d{16,19}\b`),
+		Valid:   luhn,
+		Mask:    keepEnds(0, 4),
+	}
+}
+
+// 保留开头 head 位和结尾 tail 位, 中间替换成星号
+func keepEnds(head, tail int) func(string) string {
+	return func(s string) string {
+		if len(s) <= head+tail {
+			return strings.Repeat("*", len(s))
+		}
+		return s[:head] + strings.Repeat("*", len(s)-head-tail) + s[len(s)-tail:]
+	}
+}
+
+// Luhn 校验
+func luhn(s string) bool {
+	var sum int
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		d := int(s[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func (r *Redactor) mask() string {
+	if r.Mask == "" {
+		return _defaultMask
+	}
+	return r.Mask
+}
+
+// Redact 过滤 httputil.DumpRequest 格式的请求内容, 无法解析时只执行正则检测
+func (r *Redactor) Redact(dump string) string {
+	if r == nil || dump == "" {
+		return dump
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(dump)))
+	if err != nil {
+		return r.detect(dump)
+	}
+	// 没有 Content-Length 的请求体 http.ReadRequest 读不到, 直接截取空行之后的内容
+	var body []byte
+	if len(req.TransferEncoding) > 0 {
+		body, _ = ioutil.ReadAll(req.Body)
+	} else if idx := strings.Index(dump, "\r\n\r\n"); idx >= 0 {
+		body = []byte(dump[idx+4:])
+	}
+
+	uri := r.RedactURI(req.RequestURI)
+	r.redactHeader(req.Header)
+	if redacted := r.redactBody(req.Header.Get("Content-Type"), body); !bytes.Equal(redacted, body) {
+		body = redacted
+		if req.Header.Get("Content-Length") != "" {
+			req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%s %s %s\r\n", req.Method, uri, req.Proto)
+	if req.Host != "" {
+		fmt.Fprintf(buf, "Host: %s\r\n", req.Host)
+	}
+	_ = req.Header.Write(buf)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	return r.detect(buf.String())
+}
+
+// RedactURI 屏蔽请求路径中的敏感 query 参数
+func (r *Redactor) RedactURI(uri string) string {
+	if r == nil {
+		return uri
+	}
+
+	idx := strings.IndexByte(uri, '?')
+	if idx < 0 {
+		return r.detect(uri)
+	}
+	query := redactQuery(uri[idx+1:], r.mask(), func(key string) bool {
+		return containsFold(r.QueryParams, key)
+	})
+	return r.detect(uri[:idx+1] + query)
+}
+
+// 屏蔽 query 格式的参数, 保留原来的顺序和编码
+func redactQuery(raw, mask string, match func(key string) bool) string {
+	parts := strings.Split(raw, "&")
+	for i, part := range parts {
+		kv := strings.SplitN(part, "=", 2)
+		key, err := url.QueryUnescape(kv[0])
+		if err != nil {
+			key = kv[0]
+		}
+		if len(kv) == 2 && match(key) {
+			parts[i] = kv[0] + "=" + mask
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// 屏蔽请求头和 cookie, 同样适用于 gRPC 的 metadata
+func (r *Redactor) redactHeader(h http.Header) {
+	for key, values := range h {
+		switch {
+		case containsFold(r.Headers, key):
+			for i := range values {
+				values[i] = r.mask()
+			}
+		case strings.EqualFold(key, "Cookie"):
+			for i := range values {
+				values[i] = r.redactCookie(values[i])
+			}
+		}
+	}
+}
+
+// 屏蔽 cookie 的值, 保留 cookie 的名字
+func (r *Redactor) redactCookie(raw string) string {
+	parts := strings.Split(raw, ";")
+	for i, part := range parts {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if len(r.Cookies) == 0 || containsFold(r.Cookies, kv[0]) {
+			parts[i] = kv[0] + "=" + r.mask()
+		} else {
+			parts[i] = strings.TrimSpace(part)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// 按照请求体的类型屏蔽字段
+func (r *Redactor) redactBody(contentType string, body []byte) []byte {
+	if len(body) == 0 || len(r.BodyFields) == 0 {
+		return body
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		form := redactQuery(string(body), r.mask(), func(key string) bool {
+			return r.matchField(key, key)
+		})
+		return []byte(form)
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || mediaType == "":
+		return r.redactJSON(body)
+	}
+
+	return body
+}
+
+// 屏蔽 JSON 中的字段, 不是合法的 JSON 时(比如超过缓存上限被截断)按照文本中的 key=value 规则屏蔽
+func (r *Redactor) redactJSON(body []byte) []byte {
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return []byte(r.redactText(r.textPattern(), string(body)))
+	}
+
+	v = r.walkJSON("", v)
+	data, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+func (r *Redactor) walkJSON(path string, v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if r.matchField(childPath, key) {
+				value[key] = r.mask()
+				continue
+			}
+			value[key] = r.walkJSON(childPath, child)
+		}
+	case []interface{}:
+		// 数组的下标不计入路径
+		for i, child := range value {
+			value[i] = r.walkJSON(path, child)
+		}
+	}
+	return v
+}
+
+// 判断字段是否需要屏蔽
+func (r *Redactor) matchField(path, key string) bool {
+	for _, field := range r.BodyFields {
+		if strings.Contains(field, ".") {
+			if strings.EqualFold(field, path) {
+				return true
+			}
+		} else if strings.EqualFold(field, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// 文本中 key=value 形式的敏感字段, 比如 SQL 中的 password = 'xxx', 日志中的 token=xxx 和 "secret":"xxx"
+// 字段名取自 BodyFields 和 QueryParams, 带点号的字段取最后一段, 没有字段时返回 nil, 每个 Redactor 只编译一次
+func (r *Redactor) textPattern() *regexp.Regexp {
+	r.once.Do(func() {
+		r.text = r.compileTextPattern()
+	})
+	return r.text
+}
+
+func (r *Redactor) compileTextPattern() *regexp.Regexp {
+	var names, keys []string
+	for _, field := range append(append([]string(nil), r.BodyFields...), r.QueryParams...) {
+		if idx := strings.LastIndexByte(field, '.'); idx >= 0 {
+			field = field[idx+1:]
+		}
+		if field != "" && !containsFold(names, field) {
+			names = append(names, field)
+			keys = append(keys, regexp.QuoteMeta(field))
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return regexp.MustCompile(`(?i)(["'` + "`" + `]?\b(?:` + strings.Join(keys, "|") + `)\b["'` + "`" + `]?\s*[=:]\s*)` +
+		`('(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"|[^\s,;&)]+)`)
+}
+
+// 屏蔽文本中的敏感字段并执行正则检测, 带引号的值保留引号, pattern 为 nil 时只执行正则检测
+func (r *Redactor) redactText(pattern *regexp.Regexp, s string) string {
+	if pattern != nil {
+		s = pattern.ReplaceAllStringFunc(s, func(match string) string {
+			sub := pattern.FindStringSubmatch(match)
+			value := sub[2]
+			if q := value[0]; (q == '\'' || q == '"') && len(value) >= 2 {
+				return sub[1] + string(q) + r.mask() + string(q)
+			}
+			return sub[1] + r.mask()
+		})
+	}
+	return r.detect(s)
+}
+
+// 执行正则检测
+func (r *Redactor) detect(s string) string {
+	for _, d := range r.Detectors {
+		if d == nil || d.Pattern == nil {
+			continue
+		}
+		s = d.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if d.Valid != nil && !d.Valid(match) {
+				return match
+			}
+			if d.Mask != nil {
+				return d.Mask(match)
+			}
+			return r.mask()
+		})
+	}
+	return s
+}
+
+// 不区分大小写判断是否包含
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// 按照 key 排序格式化请求头, 用于 gRPC metadata 等非 HTTP 的场景
+func formatHeader(h http.Header) string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := new(bytes.Buffer)
+	for _, k := range keys {
+		fmt.Fprintf(buf, "%s: %s\r\n", k, strings.Join(h[k], ", "))
+	}
+	return buf.String()
+}
@@ -0,0 +1,94 @@
+package ject
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"strings"
+	"testing"
+)
+
+func TestRedactorRedact(t *testing.T) {
+	body := `{"user":{"name":"jacy","password":"p@ss-w0rd","mobile":"13812345678"},"items":[{"token":"abc"}],"id_card":"11010519491231002X"}`
+	r := httptest.NewRequest(http.MethodPost, "/pay?order=1&access_token=secret-token", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer eyJhbGciOi")
+	r.Header.Set("Cookie", "session=s3cr3t; lang=zh")
+	r.Header.Set("X-Card", "6222021234567890123")
+	dump, _ := httputil.DumpRequest(r, true)
+
+	got := DefaultRedactor().Redact(string(dump))
+	for _, leaked := range []string{"secret-token", "eyJhbGciOi", "s3cr3t", "p@ss-w0rd", `"abc"`, "13812345678", "11010519491231002X"} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("%q leaked in\n%s", leaked, got)
+		}
+	}
+	for _, kept := range []string{"order=1", "session=******", "lang=******", `"name":"jacy"`, "138****5678", "110***********002X"} {
+		if !strings.Contains(got, kept) {
+			t.Errorf("%q missing in\n%s", kept, got)
+		}
+	}
+	// 没有通过 Luhn 校验的数字不是银行卡号
+	if !strings.Contains(got, "6222021234567890123") {
+		t.Errorf("non-luhn number should be kept\n%s", got)
+	}
+}
+
+func TestRedactorForm(t *testing.T) {
+	r := &Redactor{BodyFields: []string{"user.password", "pwd"}, Mask: "x"}
+	form := []byte("pwd=1&password=2")
+	if got := string(r.redactBody("application/x-www-form-urlencoded", form)); got != "pwd=x&password=2" {
+		t.Fatalf("form = %s", got)
+	}
+	js := []byte(`{"password":"1","user":{"password":"2"}}`)
+	if got := string(r.redactBody("application/json; charset=utf-8", js)); got != `{"password":"1","user":{"password":"x"}}` {
+		t.Fatalf("json = %s", got)
+	}
+}
+
+func TestEntryRedacted(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false))
+	cj.AddHook(hook)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/nil?token=t0ken", nil)
+	r.Header.Set("Authorization", "Basic YWdhdmU=")
+	newPanicEngine(cj).ServeHTTP(w, r)
+
+	e := hook.entries[0]
+	if strings.Contains(e.RequestURI, "t0ken") || strings.Contains(e.RequestContent, "t0ken") || strings.Contains(e.RequestContent, "YWdhdmU=") {
+		t.Fatalf("entry leaks secrets: %s\n%s", e.RequestURI, e.RequestContent)
+	}
+}
+
+func TestRedactTruncatedJSONBody(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetBodyCaptureLimit(40))
+	cj.AddHook(hook)
+
+	handler := RecoveryHandler(cj, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+		panic("after read")
+	}))
+	body := `{"password":"hunter2secret","nickname":"` + strings.Repeat("x", 64) + `"}`
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	got := hook.entries[0].RequestContent
+	if strings.Contains(got, "hunter2secret") || !strings.Contains(got, `"password":"******"`) || !strings.Contains(got, "[truncated") {
+		t.Fatalf("request content %q", got)
+	}
+}
+
+func TestRedactorTextPatternCompiledOnce(t *testing.T) {
+	r := DefaultRedactor()
+	if p := r.textPattern(); p == nil || p != r.textPattern() {
+		t.Fatal("text pattern should be compiled once per redactor")
+	}
+	if (&Redactor{}).textPattern() != nil {
+		t.Fatal("redactor without fields should have no text pattern")
+	}
+}
@@ -0,0 +1,108 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/laxiaohong/agave/encoding/json"
+)
+
+// 设置记录 panic 首次出现版本的文件, 报告中会标明 panic 是否是当前版本新出现的
+func SetReleaseLedger(path string) InjectOption {
+	return func(c *Inject) {
+		c.ledgerPath = path
+	}
+}
+
+// 每个 panic 指纹首次出现的记录
+type ledgerRecord struct {
+	Release   string    `json:"release"`    // 首次出现的版本
+	FirstSeen time.Time `json:"first_seen"` // 首次出现的时间
+	Location  string    `json:"location"`   // 首次出现时栈顶的业务代码位置
+}
+
+// releaseLedger 本地保存的 panic 首次出现版本
+type releaseLedger struct {
+	mu      sync.Mutex
+	path    string
+	records map[string]*ledgerRecord
+}
+
+func newReleaseLedger(path string) (*releaseLedger, error) {
+	l := &releaseLedger{path: path, records: make(map[string]*ledgerRecord, 16)}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &l.records); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// 记录指纹, 返回首次出现的版本以及首次出现的版本是否就是当前版本
+func (l *releaseLedger) observe(fp, release, location string) (string, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if record, ok := l.records[fp]; ok {
+		return record.Release, record.Release == release, nil
+	}
+
+	l.records[fp] = &ledgerRecord{Release: release, FirstSeen: time.Now(), Location: location}
+	return release, true, l.save()
+}
+
+// 先写临时文件再改名, 避免进程中途退出时文件损坏
+func (l *releaseLedger) save() error {
+	data, err := json.Marshal(l.records)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// 标记报告中的 panic 首次出现的版本
+func (c *Inject) markRelease(entry *Entry) {
+	if c.ledger == nil || entry.Fingerprint == "" {
+		return
+	}
+
+	var location string
+	for _, f := range entry.Frames {
+		if f.InApp {
+			location = fmt.Sprintf("%s.%s (%s:%d)", f.Package, f.Function, f.File, f.Line)
+			break
+		}
+	}
+
+	release, isNew, err := c.ledger.observe(entry.Fingerprint, entry.Build.Release(), location)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "ject: release ledger err:%s\n", err)
+	}
+	entry.FirstSeenRelease = release
+	entry.NewInRelease = isNew
+}
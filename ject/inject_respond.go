@@ -0,0 +1,136 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/laxiaohong/agave/encoding/json"
+)
+
+const (
+	_mimeJSON  = "application/json"
+	_mimeHTML  = "text/html"
+	_mimePlain = "text/plain"
+)
+
+// Responder 在 panic 之后向客户端写入响应, entry 是本次 panic 的报告
+// 响应已经开始写出或者连接已经断开时不会被调用
+type Responder func(w http.ResponseWriter, r *http.Request, entry *Entry)
+
+// ErrorBody 默认的 JSON 响应格式
+type ErrorBody struct {
+	Code      int    `json:"code"`                 // HTTP 状态码
+	Message   string `json:"message"`              // 错误信息
+	RequestID string `json:"request_id,omitempty"` // 请求 ID, 用于客户端反馈问题
+}
+
+// 设置 panic 之后的响应, nil 表示只返回 500 状态码, 不写入响应体
+func SetResponder(f Responder) InjectOption {
+	return func(c *Inject) {
+		c.responder = f
+	}
+}
+
+// 设置回显请求 ID 的响应头, 为空时不回显
+func SetRequestIDHeader(name string) InjectOption {
+	return func(c *Inject) {
+		c.requestIDHeader = name
+	}
+}
+
+// DefaultResponder 按照 Accept 请求头返回 JSON, HTML 或者纯文本, 默认返回 JSON
+func DefaultResponder(w http.ResponseWriter, r *http.Request, entry *Entry) {
+	body := ErrorBody{
+		Code:      http.StatusInternalServerError,
+		Message:   http.StatusText(http.StatusInternalServerError),
+		RequestID: entry.RequestID,
+	}
+
+	var (
+		contentType string
+		data        []byte
+	)
+	switch negotiate(r.Header.Get("Accept"), _mimeJSON, _mimeHTML, _mimePlain) {
+	case _mimeHTML:
+		contentType = "text/html; charset=utf-8"
+		data = []byte(fmt.Sprintf("<!DOCTYPE html>\n<html><head><title>%d %s</title></head>"+
+			"<body><h1>%d %s</h1><p>Request ID: %s</p></body></html>\n",
+			body.Code, html.EscapeString(body.Message), body.Code, html.EscapeString(body.Message), html.EscapeString(body.RequestID)))
+	case _mimePlain:
+		contentType = "text/plain; charset=utf-8"
+		data = []byte(fmt.Sprintf("%d %s\nrequest_id: %s\n", body.Code, body.Message, body.RequestID))
+	default:
+		contentType = "application/json; charset=utf-8"
+		data, _ = json.Marshal(body)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(body.Code)
+	_, _ = w.Write(data)
+}
+
+// 写入 panic 之后的响应, 先回显请求 ID, 再交给 Responder
+func (c *Inject) respond(w http.ResponseWriter, r *http.Request, entry *Entry) {
+	if c.requestIDHeader != "" && entry.RequestID != "" {
+		w.Header().Set(c.requestIDHeader, entry.RequestID)
+	}
+
+	if c.responder == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.responder(w, r, entry)
+}
+
+// 按照 Accept 请求头选择 offers 中的类型, 质量相同时按照 Accept 中的顺序, 都不接受时返回第一个
+func negotiate(accept string, offers ...string) string {
+	if accept == "" {
+		return offers[0]
+	}
+
+	best, bestQ := offers[0], 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+		for _, offer := range offers {
+			if matchMediaType(mediaType, offer) {
+				best, bestQ = offer, q
+				break
+			}
+		}
+	}
+
+	return best
+}
+
+// 支持 */* 和 text/* 这样的通配
+func matchMediaType(pattern, offer string) bool {
+	if pattern == "*/*" || pattern == offer {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(offer, strings.TrimSuffix(pattern, "*"))
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package ject
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/laxiaohong/agave/encoding/json"
+	"github.com/laxiaohong/agave/reqid"
+)
+
+func TestRecoveryResponder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cj := NewInject(SetAsync(false))
+	engine := gin.New()
+	engine.Use(RecoveryHandlerFunc(cj))
+	engine.GET("/", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	for _, tc := range []struct {
+		accept      string
+		contentType string
+		contains    string
+	}{
+		{"", "application/json", `"request_id":"trace-2"`},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", "text/html", "Request ID: trace-2"},
+		{"text/plain", "text/plain", "request_id: trace-2"},
+		{"application/json;q=0.5, text/*;q=0.9", "text/html", "<h1>500 Internal Server Error</h1>"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(requestID, "trace-2")
+		r.Header.Set("Accept", tc.accept)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+
+		if w.Code != http.StatusInternalServerError || w.Header().Get(requestID) != "trace-2" {
+			t.Fatalf("accept %q: status=%d header=%q", tc.accept, w.Code, w.Header().Get(requestID))
+		}
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), tc.contentType) || !strings.Contains(w.Body.String(), tc.contains) {
+			t.Fatalf("accept %q: content-type=%q body=%s", tc.accept, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
+
+func TestRecoveryHandlerCustomResponder(t *testing.T) {
+	cj := NewInject(SetAsync(false), SetRequestIDHeader("X-Request-Id"), SetResponder(func(w http.ResponseWriter, r *http.Request, entry *Entry) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		data, _ := json.Marshal(map[string]string{"error": entry.PanicValue, "trace": entry.RequestID})
+		_, _ = w.Write(data)
+	}))
+	handler := RecoveryHandler(cj, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("custom")
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(requestID, "trace-3")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("X-Request-Id") != "trace-3" || body["error"] != "custom" || body["trace"] != "trace-3" {
+		t.Fatalf("status=%d header=%q body=%v", w.Code, w.Header().Get("X-Request-Id"), body)
+	}
+}
+
+func TestRecoveryGeneratesRequestID(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false))
+	cj.AddHook(hook)
+	handler := RecoveryHandler(cj, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("no request id")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	id := w.Header().Get(requestID)
+	if len(id) != 26 || hook.entries[0].RequestID != id || !strings.Contains(w.Body.String(), id) {
+		t.Fatalf("header %q, entry %q, body %s", id, hook.entries[0].RequestID, w.Body.String())
+	}
+}
+
+func TestRecoveryPropagatesRequestID(t *testing.T) {
+	cj := NewInject(SetAsync(false))
+
+	var fromGin string
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(RecoveryHandlerFunc(cj))
+	engine.GET("/", func(c *gin.Context) {
+		fromGin = reqid.FromContext(c.Request.Context())
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(requestID, "trace-4")
+	engine.ServeHTTP(httptest.NewRecorder(), r)
+	if fromGin != "trace-4" {
+		t.Fatalf("gin handler saw request id %q", fromGin)
+	}
+
+	var fromHTTP string
+	handler := RecoveryHandler(cj, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fromHTTP = reqid.FromContext(r.Context())
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if len(fromHTTP) != 26 {
+		t.Fatalf("net/http handler should see the generated request id, got %q", fromHTTP)
+	}
+}
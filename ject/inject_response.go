@@ -0,0 +1,236 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 设置从 gin 上下文中补充报告的函数, 比如从 c.Keys 中读取用户和租户信息写入 Entry.Data
+func SetGinEnricher(f func(c *gin.Context, entry *Entry)) InjectOption {
+	return func(c *Inject) {
+		c.ginEnricher = f
+	}
+}
+
+// 设置可信的代理, 支持 IP 和 CIDR, 比如: 10.0.0.0/8, 127.0.0.1
+// 只有直连地址是可信代理时才采用 X-Forwarded-For 和 X-Real-Ip, 默认不信任任何代理, 只使用直连地址
+// gin 的请求使用 gin.Engine 自己的可信代理配置
+func SetTrustedProxies(proxies ...string) InjectOption {
+	return func(c *Inject) {
+		c.trustedProxies = make([]*net.IPNet, 0, len(proxies))
+		for _, proxy := range proxies {
+			cidr := proxy
+			if !strings.Contains(cidr, "/") {
+				if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+					cidr += "/32"
+				} else {
+					cidr += "/128"
+				}
+			}
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "ject: invalid trusted proxy %q: %s\n", proxy, err)
+				continue
+			}
+			c.trustedProxies = append(c.trustedProxies, ipNet)
+		}
+	}
+}
+
+// 构造 gin 请求的报告, 补充路由, 处理函数和响应的信息
+func (c *Inject) ginEntry(ctx context.Context, gc *gin.Context, start time.Time) func(string) *Entry {
+	build := c.httpEntry(ctx, gc.Request)
+
+	return func(cause string) *Entry {
+		entry := build(cause)
+		entry.Route = gc.FullPath()
+		entry.Handler = gc.HandlerName()
+		entry.Elapsed = time.Since(start).String()
+		entry.ClientIP = gc.ClientIP()
+		entry.Written = gc.Writer.Written()
+		entry.Status = gc.Writer.Status()
+		entry.Size = gc.Writer.Size()
+
+		if c.ginEnricher != nil {
+			c.ginEnricher(gc, entry)
+		}
+		return entry
+	}
+}
+
+// 构造 net/http 请求的报告, 补充响应的信息
+func (c *Inject) responseEntry(ctx context.Context, r *http.Request, w *responseWriter, start time.Time) func(string) *Entry {
+	build := c.httpEntry(ctx, r)
+
+	return func(cause string) *Entry {
+		entry := build(cause)
+		entry.Elapsed = time.Since(start).String()
+		entry.Written = w.written()
+		entry.Status = w.status
+		entry.Size = w.size
+		return entry
+	}
+}
+
+// 获取客户端 IP, 直连地址是可信代理时使用代理转发的地址
+// X-Forwarded-For 从右往左跳过可信代理, 第一个不可信的地址就是客户端, 客户端伪造的左侧地址不会被采用
+func (c *Inject) clientIP(r *http.Request) string {
+	remote := strings.TrimSpace(r.RemoteAddr)
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !c.trustedProxy(remote) {
+		return remote
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(hops[i])
+			if ip == "" {
+				continue
+			}
+			if i == 0 || !c.trustedProxy(ip) {
+				return ip
+			}
+		}
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-Ip")); ip != "" {
+		return ip
+	}
+	return remote
+}
+
+func (c *Inject) trustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range c.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+const _noWritten = -1
+
+// responseWriter 记录 net/http 响应的状态码和已经写出的字节数
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK, size: _noWritten}
+}
+
+func (w *responseWriter) written() bool {
+	return w.size != _noWritten
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.written() {
+		return
+	}
+	w.status = code
+	w.size = 0
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if !w.written() {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.written() {
+			w.WriteHeader(http.StatusOK)
+		}
+		flusher.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("ject: the ResponseWriter doesn't support the Hijacker interface")
+	}
+	if !w.written() {
+		w.size = 0
+	}
+	return hijacker.Hijack()
+}
+
+// 按照被包装的 ResponseWriter 支持的接口返回对应的包装, 避免声明实际不支持的 http.Pusher 和 io.ReaderFrom
+func (w *responseWriter) wrap() http.ResponseWriter {
+	_, pusher := w.ResponseWriter.(http.Pusher)
+	_, readerFrom := w.ResponseWriter.(io.ReaderFrom)
+	switch {
+	case pusher && readerFrom:
+		return &pushReaderFromWriter{w}
+	case pusher:
+		return &pushWriter{w}
+	case readerFrom:
+		return &readerFromWriter{w}
+	}
+	return w
+}
+
+func (w *responseWriter) push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// 使用被包装的 ResponseWriter 的 ReadFrom, 保留 sendfile 等优化
+func (w *responseWriter) readFrom(src io.Reader) (int64, error) {
+	if !w.written() {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	w.size += int(n)
+	return n, err
+}
+
+type pushWriter struct{ *responseWriter }
+
+func (w *pushWriter) Push(target string, opts *http.PushOptions) error {
+	return w.push(target, opts)
+}
+
+type readerFromWriter struct{ *responseWriter }
+
+func (w *readerFromWriter) ReadFrom(src io.Reader) (int64, error) {
+	return w.readFrom(src)
+}
+
+type pushReaderFromWriter struct{ *responseWriter }
+
+func (w *pushReaderFromWriter) Push(target string, opts *http.PushOptions) error {
+	return w.push(target, opts)
+}
+
+func (w *pushReaderFromWriter) ReadFrom(src io.Reader) (int64, error) {
+	return w.readFrom(src)
+}
@@ -0,0 +1,84 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// 钩子投递失败后的重试策略
+type RetryPolicy struct {
+	MaxAttempts int           // 最多尝试的次数, 包含第一次投递
+	BaseDelay   time.Duration // 第一次重试前的等待时间, 之后指数增长
+	MaxDelay    time.Duration // 单次等待的上限
+	Jitter      float64       // 随机抖动比例, 取值 [0, 1]
+}
+
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+	Jitter:      0.2,
+}
+
+// 设置钩子投递失败后的重试策略
+func SetRetryPolicy(p RetryPolicy) InjectOption {
+	return func(c *Inject) {
+		c.retry = p
+	}
+}
+
+// 第 attempt 次重试前需要等待的时间, attempt 从 1 开始
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 && delay > 0 {
+		// 在 [-jitter, +jitter] 范围内随机浮动, 避免多个实例同时重试
+		delta := (rand.Float64()*2 - 1) * p.Jitter * float64(delay)
+		delay += time.Duration(delta)
+	}
+
+	return delay
+}
+
+// 按照重试策略调用钩子, 记录每次调用的结果, 返回最后一次的错误
+func (c *Inject) fireWithRetry(ctx context.Context, s *hookSlot, entry *Entry) error {
+	attempts := c.retry.MaxAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			timer := time.NewTimer(c.retry.backoff(i))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("%v, retry canceled: %w", err, ctx.Err())
+			case <-timer.C:
+			}
+		}
+
+		start := time.Now()
+		err = safeFire(ctx, s.hook, entry)
+		s.stats.observe(start, err)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,179 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// 进程的启动时间, 近似为本包初始化的时间
+var processStart = time.Now()
+
+// 从 cgroup 和 mountinfo 中识别容器 ID, 只匹配容器运行时的路径, 避免把 overlay 层等其他哈希当作容器 ID
+// cgroup v1 的 /docker/<id> 和 /kubepods/.../<id>, systemd 的 docker-<id>.scope 和 cri-containerd-<id>.scope,
+// mountinfo 中的 /var/lib/docker/containers/<id>/
+var containerIDPattern = regexp.MustCompile(
+	`(?:/docker/|/kubepods/(?:[^/\s]+/)*|docker-|cri-containerd-)([0-9a-f]{64})(?:\.scope)?(?:/|\s|$)` +
+		`|/containers/([0-9a-f]{64})/`)
+
+// 设置是否在报告中附带运行时和进程的快照, 采集内存信息会短暂地停止整个程序
+func SetRuntimeSnapshot(enable bool) InjectOption {
+	return func(c *Inject) {
+		c.runtimeSnapshot = enable
+	}
+}
+
+// RuntimeSnapshot panic 时进程和运行时的状态
+type RuntimeSnapshot struct {
+	PID          int            `json:"pid"`           // 进程 ID
+	Uptime       string         `json:"uptime"`        // 进程已经运行的时间
+	NumGoroutine int            `json:"num_goroutine"` // 协程数量
+	GOMAXPROCS   int            `json:"gomaxprocs"`    // 可以同时执行的 CPU 数
+	NumCPU       int            `json:"num_cpu"`       // 机器的 CPU 数
+	OpenFDs      int            `json:"open_fds"`      // 打开的文件描述符数量, -1 表示无法获取
+	Mem          MemSnapshot    `json:"mem"`           // 内存信息
+	Container    *ContainerInfo `json:"container"`     // 容器和 Pod 信息, 不在容器中运行时为空
+}
+
+// MemSnapshot runtime.MemStats 中的关键数据, 单位是字节
+type MemSnapshot struct {
+	Alloc        uint64 `json:"alloc"`          // 堆上正在使用的内存
+	TotalAlloc   uint64 `json:"total_alloc"`    // 累计分配的内存
+	Sys          uint64 `json:"sys"`            // 从系统申请的内存
+	HeapInuse    uint64 `json:"heap_inuse"`     // 正在使用的堆 span
+	HeapObjects  uint64 `json:"heap_objects"`   // 堆上的对象数量
+	StackInuse   uint64 `json:"stack_inuse"`    // 协程栈使用的内存
+	NumGC        uint32 `json:"num_gc"`         // GC 次数
+	PauseTotalNs uint64 `json:"pause_total_ns"` // GC 累计暂停的时间
+	LastGC       string `json:"last_gc"`        // 上一次 GC 的时间
+}
+
+// ContainerInfo 容器和 Kubernetes 的身份信息
+type ContainerInfo struct {
+	ID        string `json:"id"`        // 容器 ID, 从 cgroup 文件中读取
+	PodName   string `json:"pod_name"`  // Pod 名称
+	Namespace string `json:"namespace"` // Pod 所在的命名空间
+	NodeName  string `json:"node_name"` // Pod 所在的节点
+	PodIP     string `json:"pod_ip"`    // Pod IP
+}
+
+// 采集运行时快照
+func (c *Inject) snapshot() *RuntimeSnapshot {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	snap := &RuntimeSnapshot{
+		PID:          os.Getpid(),
+		Uptime:       time.Since(processStart).Round(time.Second).String(),
+		NumGoroutine: runtime.NumGoroutine(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		NumCPU:       runtime.NumCPU(),
+		OpenFDs:      openFDs(),
+		Mem: MemSnapshot{
+			Alloc:        ms.Alloc,
+			TotalAlloc:   ms.TotalAlloc,
+			Sys:          ms.Sys,
+			HeapInuse:    ms.HeapInuse,
+			HeapObjects:  ms.HeapObjects,
+			StackInuse:   ms.StackInuse,
+			NumGC:        ms.NumGC,
+			PauseTotalNs: ms.PauseTotalNs,
+		},
+		Container: containerInfo(),
+	}
+	if ms.LastGC > 0 {
+		snap.Mem.LastGC = c.TimeFormatter(time.Unix(0, int64(ms.LastGC)))
+	}
+
+	return snap
+}
+
+// 统计打开的文件描述符, 只支持提供 /proc 或者 /dev/fd 的系统
+func openFDs() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		f, err := os.Open(dir)
+		if err != nil {
+			continue
+		}
+		names, err := f.Readdirnames(-1)
+		_ = f.Close()
+		if err != nil {
+			continue
+		}
+		// 减去读取目录时自己打开的描述符
+		return len(names) - 1
+	}
+	return -1
+}
+
+var (
+	containerOnce sync.Once
+	container     *ContainerInfo
+)
+
+// 容器信息在进程的生命周期内不会改变, 只读取一次
+func containerInfo() *ContainerInfo {
+	containerOnce.Do(func() {
+		info := &ContainerInfo{
+			ID:        readContainerID("/proc/self/cgroup", "/proc/self/mountinfo"),
+			PodName:   firstEnv("POD_NAME", "MY_POD_NAME"),
+			Namespace: firstEnv("POD_NAMESPACE", "MY_POD_NAMESPACE"),
+			NodeName:  firstEnv("NODE_NAME", "MY_NODE_NAME"),
+			PodIP:     firstEnv("POD_IP", "MY_POD_IP"),
+		}
+		// Kubernetes 中的主机名默认就是 Pod 名称
+		if info.PodName == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+			info.PodName, _ = os.Hostname()
+		}
+
+		if *info != (ContainerInfo{}) {
+			container = info
+		}
+	})
+	return container
+}
+
+// 从 cgroup 文件中读取容器 ID, cgroup v2 的容器需要从 mountinfo 中读取
+func readContainerID(files ...string) string {
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if id := matchContainerID(scanner.Text()); id != "" {
+				_ = f.Close()
+				return id
+			}
+		}
+		_ = f.Close()
+	}
+	return ""
+}
+
+func matchContainerID(line string) string {
+	for _, id := range containerIDPattern.FindStringSubmatch(line) {
+		if len(id) == 64 {
+			return id
+		}
+	}
+	return ""
+}
+
+func firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"bytes"
+	"container/list"
+	"io/ioutil"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+const (
+	_defaultSourceContext   = 3  // 默认展示业务栈帧前后的源码行数
+	_defaultSourceCacheSize = 64 // 默认缓存的源码文件数量
+)
+
+// 设置业务栈帧前后展示的源码行数, 0 表示只展示出错的那一行
+func SetSourceContext(lines int) InjectOption {
+	return func(c *Inject) {
+		c.sourceContext = lines
+	}
+}
+
+// 设置缓存的源码文件数量
+func SetSourceCacheSize(n int) InjectOption {
+	return func(c *Inject) {
+		c.sourceCacheSize = n
+	}
+}
+
+// 缓存中的源码文件, lines 为 nil 表示文件不存在或者读取失败
+type sourceFile struct {
+	name  string
+	lines [][]byte
+}
+
+// 源码文件的 LRU 缓存, panic 风暴时不会反复读取磁盘
+type sourceCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newSourceCache(size int) *sourceCache {
+	if size <= 0 {
+		size = _defaultSourceCacheSize
+	}
+	return &sourceCache{size: size, ll: list.New(), items: make(map[string]*list.Element, size)}
+}
+
+// 获取源码文件的内容, 读取失败的结果同样会被缓存
+func (s *sourceCache) lines(name string) [][]byte {
+	s.mu.Lock()
+	if el, ok := s.items[name]; ok {
+		s.ll.MoveToFront(el)
+		s.mu.Unlock()
+		return el.Value.(*sourceFile).lines
+	}
+	s.mu.Unlock()
+
+	var lines [][]byte
+	if data, err := ioutil.ReadFile(name); err == nil {
+		lines = bytes.Split(data, []byte{'\n'})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[name]; ok {
+		s.ll.MoveToFront(el)
+		return el.Value.(*sourceFile).lines
+	}
+	s.items[name] = s.ll.PushFront(&sourceFile{name: name, lines: lines})
+	for s.ll.Len() > s.size {
+		oldest := s.ll.Back()
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(*sourceFile).name)
+	}
+	return lines
+}
+
+// contextLines 返回第 n 行前后各 size 行, 行号从 1 开始
+func contextLines(lines [][]byte, n, size int) ([]string, []string) {
+	if size <= 0 || n < 1 || n > len(lines) {
+		return nil, nil
+	}
+
+	pre := make([]string, 0, size)
+	for i := n - 1 - size; i < n-1; i++ {
+		if i >= 0 {
+			pre = append(pre, string(bytes.TrimRight(lines[i], "\r")))
+		}
+	}
+	post := make([]string, 0, size)
+	for i := n; i < n+size && i < len(lines); i++ {
+		post = append(post, string(bytes.TrimRight(lines[i], "\r")))
+	}
+	return pre, post
+}
+
+// 构建信息中的模块
+type module struct {
+	path    string
+	version string
+}
+
+var (
+	modulesOnce sync.Once
+	modules     []module
+)
+
+// 根据包路径找到所属的模块, 用于没有源码时定位代码版本
+func moduleOf(pkg string) (string, string) {
+	modulesOnce.Do(func() {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		modules = append(modules, module{path: info.Main.Path, version: info.Main.Version})
+		for _, dep := range info.Deps {
+			version := dep.Version
+			if dep.Replace != nil {
+				version = dep.Replace.Version
+			}
+			modules = append(modules, module{path: dep.Path, version: version})
+		}
+	})
+
+	var best module
+	for _, m := range modules {
+		if m.path == "" || len(m.path) <= len(best.path) {
+			continue
+		}
+		if pkg == m.path || strings.HasPrefix(pkg, m.path+"/") {
+			best = m
+		}
+	}
+	return best.path, best.version
+}
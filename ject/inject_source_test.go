@@ -0,0 +1,47 @@
+package ject
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSourceCacheEvicts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ject-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	names := make([]string, 3)
+	for i := range names {
+		names[i] = filepath.Join(dir, string(rune('a'+i))+".go")
+		if err = ioutil.WriteFile(names[i], []byte("l1\nl2\nl3\nl4\nl5\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache := newSourceCache(2)
+	for _, name := range names {
+		if cache.lines(name) == nil {
+			t.Fatalf("read %s failed", name)
+		}
+	}
+	if _, ok := cache.items[names[0]]; ok || cache.ll.Len() != 2 {
+		t.Fatalf("oldest file should be evicted, len=%d", cache.ll.Len())
+	}
+
+	// 文件被删除之后仍然命中缓存, 不再读取磁盘
+	_ = os.Remove(names[2])
+	lines := cache.lines(names[2])
+	pre, post := contextLines(lines, 3, 2)
+	if !reflect.DeepEqual(pre, []string{"l1", "l2"}) || !reflect.DeepEqual(post, []string{"l4", "l5"}) {
+		t.Fatalf("unexpected context pre=%v post=%v", pre, post)
+	}
+
+	if cache.lines(filepath.Join(dir, "missing.go")) != nil {
+		t.Fatal("missing file should have no lines")
+	}
+}
@@ -0,0 +1,223 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/laxiaohong/agave/encoding/json"
+)
+
+const (
+	_spoolFile     = "ject-spool.jsonl" // 死信文件名
+	_replaySuffix  = ".replay"          // 正在重放的死信文件后缀
+	_maxSpoolLine  = 8 << 20            // 单条死信记录的最大长度
+	_spoolFileMode = 0644
+)
+
+// 死信记录, 每行一条 JSON
+type spoolRecord struct {
+	Hook  string    `json:"hook"`  // 投递失败的钩子名字
+	Time  time.Time `json:"time"`  // 写入死信的时间
+	Entry *Entry    `json:"entry"` // 崩溃报告
+}
+
+// 死信目录, 保存投递失败的报告
+type spool struct {
+	mu    sync.Mutex
+	flush sync.Mutex // 串行执行重放, 后注册的钩子触发的重放能读到前一次重放写回的记录
+	dir   string
+}
+
+// 设置死信目录, 通过 AddNamedHook 或者 ReplaceHooks 注册的钩子投递失败的报告会写入该目录, 按照钩子的名字重放
+// 下次启动时, 死信中的钩子名字第一次注册之后在后台重放, 也可以调用 FlushSpool 手动重放
+func SetSpoolDir(dir string) InjectOption {
+	return func(c *Inject) {
+		c.spoolDir = dir
+	}
+}
+
+func newSpool(dir string) (*spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &spool{dir: dir}, nil
+}
+
+// 追加一条死信记录
+func (s *spool) write(hook string, entry *Entry) error {
+	data, err := json.Marshal(&spoolRecord{Hook: hook, Time: time.Now(), Entry: entry})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(s.dir, _spoolFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, _spoolFileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// 取出所有待重放的记录, 返回已经改名的文件, 重放结束之后删除
+func (s *spool) take() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := filepath.Join(s.dir, _spoolFile)
+	if _, err := os.Stat(current); err == nil {
+		replay := fmt.Sprintf("%s.%d%s", current, time.Now().UnixNano(), _replaySuffix)
+		if err = os.Rename(current, replay); err != nil {
+			return nil, err
+		}
+	}
+
+	// 上一次重放中途退出时遗留的文件也一并处理
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), _spoolFile) && strings.HasSuffix(info.Name(), _replaySuffix) {
+			files = append(files, filepath.Join(s.dir, info.Name()))
+		}
+	}
+
+	return files, nil
+}
+
+// 死信中记录的所有钩子名字, 只读取不取出
+func (s *spool) pendingHooks() map[string]struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make(map[string]struct{})
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return names
+	}
+	for _, info := range infos {
+		if info.Name() != _spoolFile && !(strings.HasPrefix(info.Name(), _spoolFile) && strings.HasSuffix(info.Name(), _replaySuffix)) {
+			continue
+		}
+		records, _ := readSpoolFile(filepath.Join(s.dir, info.Name()))
+		for _, record := range records {
+			names[record.Hook] = struct{}{}
+		}
+	}
+	return names
+}
+
+// 读取死信文件中的记录
+func readSpoolFile(name string) ([]*spoolRecord, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := make([]*spoolRecord, 0, 8)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), _maxSpoolLine)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		record := new(spoolRecord)
+		if err = json.Unmarshal(line, record); err != nil || record.Entry == nil {
+			_, _ = fmt.Fprintf(os.Stderr, "ject: skip broken spool record in %s\n", name)
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// FlushSpool 重放死信目录中的报告, 再次失败的报告重新写回死信目录
+func (c *Inject) FlushSpool() error {
+	if c.spool == nil {
+		return nil
+	}
+
+	c.spool.flush.Lock()
+	defer c.spool.flush.Unlock()
+
+	files, err := c.spool.take()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		records, err := readSpoolFile(name)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			record.Entry.Ctx = context.Background()
+			c.replay(record)
+		}
+
+		if err = os.Remove(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 把死信记录按照钩子的名字重新投递, 钩子已经不存在或者被停用时保留记录
+func (c *Inject) replay(record *spoolRecord) {
+	slots := c.loadHooks()
+	if idx := indexHook(slots, record.Hook); idx >= 0 && slots[idx].enabled() {
+		c.deliver(slots[idx], record.Entry)
+		return
+	}
+
+	if err := c.spool.write(record.Hook, record.Entry); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "ject: spool err:%s\n", err)
+	}
+}
+
+// 注册的钩子中有死信在等待时在后台重放, 调用时持有 mu
+func (c *Inject) replayPending(slots []*hookSlot) {
+	if len(c.spoolPending) == 0 {
+		return
+	}
+
+	matched := false
+	for _, s := range slots {
+		if _, ok := c.spoolPending[s.name]; ok {
+			delete(c.spoolPending, s.name)
+			matched = true
+		}
+	}
+	if !matched {
+		return
+	}
+
+	go func() {
+		if err := c.FlushSpool(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "ject: flush spool err:%s\n", err)
+		}
+	}()
+}
@@ -0,0 +1,81 @@
+package ject
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type flakyHook struct {
+	mu       sync.Mutex
+	fail     int // 前 fail 次调用返回错误
+	calls    int
+	received []string
+}
+
+func (h *flakyHook) Fire(ctx context.Context, entry *Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls++
+	if h.calls <= h.fail {
+		return errors.New("endpoint unavailable")
+	}
+	h.received = append(h.received, entry.RequestID)
+	return nil
+}
+
+func (h *flakyHook) delivered() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.received...)
+}
+
+func TestRetryThenSucceed(t *testing.T) {
+	hook := &flakyHook{fail: 2}
+	cj := NewInject(SetAsync(false), SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+	cj.AddHook(hook)
+
+	cj.dispatch(&Entry{Ctx: context.Background(), RequestID: "retry"})
+	if hook.calls != 3 || len(hook.received) != 1 {
+		t.Fatalf("calls=%d received=%v", hook.calls, hook.received)
+	}
+}
+
+func TestSpoolAndFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ject-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hook := &flakyHook{fail: 2}
+	cj := NewInject(SetAsync(false), SetSpoolDir(dir), SetRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}))
+	_ = cj.AddNamedHook("file", hook)
+	// 自动命名的钩子重启之后可能对应到其他钩子, 失败的报告不写入死信
+	cj.AddHook(&flakyHook{fail: 2})
+
+	cj.dispatch(&Entry{Ctx: context.Background(), RequestID: "spooled", Data: map[string]interface{}{}})
+	if len(hook.received) != 0 {
+		t.Fatalf("entry should not be delivered yet: %v", hook.received)
+	}
+	if records, _ := readSpoolFile(filepath.Join(dir, _spoolFile)); len(records) != 1 || records[0].Hook != "file" {
+		t.Fatalf("spooled records = %+v", records)
+	}
+
+	if err = cj.FlushSpool(); err != nil {
+		t.Fatal(err)
+	}
+	if len(hook.received) != 1 || hook.received[0] != "spooled" {
+		t.Fatalf("replayed entries = %v", hook.received)
+	}
+
+	infos, _ := ioutil.ReadDir(dir)
+	if len(infos) != 0 {
+		t.Fatalf("spool dir should be empty after flush, got %d files", len(infos))
+	}
+}
@@ -0,0 +1,204 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+const _selfPackage = "github.com/laxiaohong/agave/ject" // 本包的路径, 不算作业务代码
+
+var (
+	dunno     = []byte("???")
+	centerDot = []byte("·")
+	dot       = []byte(".")
+	slash     = []byte("/")
+)
+
+// 默认不属于业务代码的包前缀
+var defaultOutOfApp = []string{
+	"github.com/gin-gonic/gin",
+	_selfPackage,
+}
+
+// 结构化的栈帧
+type Frame struct {
+	Function string  `json:"function"` // 函数名, 不包含包路径, 比如: (*Inject).NewEntry
+	Package  string  `json:"package"`  // 包路径
+	File     string  `json:"file"`     // 文件路径
+	Line     int     `json:"line"`     // 行号
+	PC       uintptr `json:"pc"`       // 程序计数器
+	Source   string  `json:"source"`   // 源码行
+	InApp    bool    `json:"in_app"`   // 是否是业务代码
+
+	PreContext  []string `json:"pre_context,omitempty"`  // 出错行之前的源码
+	PostContext []string `json:"post_context,omitempty"` // 出错行之后的源码
+
+	Module        string `json:"module,omitempty"`         // 找不到源码时, 代码所属的模块
+	ModuleVersion string `json:"module_version,omitempty"` // 找不到源码时, 代码所属模块的版本
+}
+
+// 设置业务代码的包前缀, 不设置时除标准库, gin 和本包以外的代码都算业务代码
+func SetInAppPrefixes(prefixes ...string) InjectOption {
+	return func(c *Inject) {
+		c.inAppPrefixes = prefixes
+	}
+}
+
+// 设置是否在文本栈中折叠非业务代码的栈帧
+func SetCollapseFrames(collapse bool) InjectOption {
+	return func(c *Inject) {
+		c.collapseFrames = collapse
+	}
+}
+
+// 获取调用栈的 pc, 跳过 skip 层
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+1, pcs)
+	return pcs[:n]
+}
+
+// 获取触发 panic 的调用栈, 从 runtime.gopanic 的下一层开始
+// 各个拦截器的 defer 嵌套层数不同, 所以不能用固定的 skip
+func panicCallers() []uintptr {
+	pcs := callers(1)
+	for i, pc := range pcs {
+		if fn := runtime.FuncForPC(pc - 1); fn != nil && fn.Name() == "runtime.gopanic" {
+			return pcs[i+1:]
+		}
+	}
+	return pcs
+}
+
+// 把调用栈解析成结构化的栈帧
+func (c *Inject) frames(pcs []uintptr) []Frame {
+	frames := make([]Frame, 0, len(pcs))
+	iter := runtime.CallersFrames(pcs)
+	for {
+		f, more := iter.Next()
+		pkg, fn := splitFunction(f.Function)
+		frame := Frame{
+			Function: fn,
+			Package:  pkg,
+			File:     f.File,
+			Line:     f.Line,
+			PC:       f.PC,
+			InApp:    c.inApp(pkg),
+		}
+
+		lines := c.sources.lines(f.File)
+		frame.Source = string(source(lines, f.Line))
+		if lines == nil {
+			// 部署的机器上没有源码, 记录模块和版本, 方便找到对应的代码
+			frame.Module, frame.ModuleVersion = moduleOf(pkg)
+		} else if frame.InApp {
+			frame.PreContext, frame.PostContext = contextLines(lines, f.Line, c.sourceContext)
+		}
+
+		frames = append(frames, frame)
+		if !more {
+			break
+		}
+	}
+
+	return frames
+}
+
+// 判断包是否属于业务代码
+func (c *Inject) inApp(pkg string) bool {
+	if len(c.inAppPrefixes) > 0 {
+		for _, prefix := range c.inAppPrefixes {
+			if strings.HasPrefix(pkg, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if pkg == "main" {
+		return true
+	}
+	// 标准库的第一段路径中没有点号
+	if first := strings.SplitN(pkg, "/", 2)[0]; !strings.Contains(first, ".") {
+		return false
+	}
+	for _, prefix := range defaultOutOfApp {
+		if pkg == prefix || strings.HasPrefix(pkg, prefix+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+// 把栈帧渲染成文本, collapse 为 true 时连续的非业务栈帧折叠成一行
+func renderStack(frames []Frame, collapse bool) []byte {
+	buf := new(bytes.Buffer) // the returned data
+	hidden := 0
+	flush := func() {
+		if hidden > 0 {
+			fmt.Fprintf(buf, "\t... %d frames hidden ...\n", hidden)
+			hidden = 0
+		}
+	}
+
+	for _, f := range frames {
+		if collapse && !f.InApp {
+			hidden++
+			continue
+		}
+		flush()
+		// Print this much at least.  If we can't find the source, it won't show.
+		fmt.Fprintf(buf, "%s:%d (0x%x)\n", f.File, f.Line, f.PC)
+		if f.Module != "" {
+			fmt.Fprintf(buf, "\t%s: %s (%s@%s)\n", f.Function, f.Source, f.Module, f.ModuleVersion)
+		} else {
+			fmt.Fprintf(buf, "\t%s: %s\n", f.Function, f.Source)
+		}
+	}
+	flush()
+
+	return buf.Bytes()
+}
+
+// source returns a space-trimmed slice of the n'th line.
+func source(lines [][]byte, n int) []byte {
+	n-- // in stack trace, lines are 1-indexed but our array is 0-indexed
+	if n < 0 || n >= len(lines) {
+		return dunno
+	}
+	return bytes.TrimSpace(lines[n])
+}
+
+// splitFunction 把完整的函数名拆分成包路径和函数名
+func splitFunction(full string) (string, string) {
+	if full == "" {
+		return "", string(dunno)
+	}
+	name := []byte(full)
+	// The name includes the path name to the package, which is unnecessary
+	// since the file name is already included.  Plus, it has center dots.
+	// That is, we see
+	//	runtime/debug.*T·ptrmethod
+	// and want
+	//	*T.ptrmethod
+	// Also the package path might contains dot (e.g. code.google.com/...),
+	// so first eliminate the path prefix
+	var pkg []byte
+	if lastSlash := bytes.LastIndex(name, slash); lastSlash >= 0 {
+		pkg = name[:lastSlash+1]
+		name = name[lastSlash+1:]
+	}
+	if period := bytes.Index(name, dot); period >= 0 {
+		pkg = append(pkg[:len(pkg):len(pkg)], name[:period]...)
+		name = name[period+1:]
+	}
+	name = bytes.Replace(name, centerDot, dot, -1)
+	return string(pkg), string(name)
+}
@@ -0,0 +1,44 @@
+package ject
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFramesInApp(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetInAppPrefixes(_selfPackage), SetCollapseFrames(true))
+	cj.AddHook(hook)
+	serve(newPanicEngine(cj), "/nil")
+
+	entry := hook.entries[0]
+	var top Frame
+	for _, f := range entry.Frames {
+		if f.InApp {
+			top = f
+			break
+		}
+	}
+	if top.Package != _selfPackage || !top.InApp || !strings.HasPrefix(top.Function, "newPanicEngine.") {
+		t.Fatalf("unexpected top frame %+v", top)
+	}
+	if top.Source != "*ptr = 8086" {
+		t.Fatalf("unexpected source %q", top.Source)
+	}
+	if !strings.Contains(entry.Cause, "frames hidden") || strings.Contains(entry.Cause, "gin.(*Context).Next") {
+		t.Fatalf("gin frames should be collapsed:\n%s", entry.Cause)
+	}
+}
+
+func TestSplitFunction(t *testing.T) {
+	for full, want := range map[string][2]string{
+		"github.com/laxiaohong/agave/ject.(*Inject).NewEntry": {"github.com/laxiaohong/agave/ject", "(*Inject).NewEntry"},
+		"runtime/debug.Stack": {"runtime/debug", "Stack"},
+		"main.main.func1":     {"main", "main.func1"},
+	} {
+		pkg, fn := splitFunction(full)
+		if pkg != want[0] || fn != want[1] {
+			t.Errorf("splitFunction(%q) = %q, %q", full, pkg, fn)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 把 panic 作为 exception 事件记录到上下文中的 span 上, 并在报告中填充 trace ID 和 span ID
+func (c *Inject) recordSpan(entry *Entry) {
+	span := trace.SpanFromContext(entry.Ctx)
+	sc := span.SpanContext()
+	if !sc.IsValid() {
+		return
+	}
+
+	entry.TraceID = sc.TraceID().String()
+	entry.SpanID = sc.SpanID().String()
+	if !span.IsRecording() {
+		return
+	}
+
+	span.AddEvent(semconv.ExceptionEventName, trace.WithAttributes(
+		semconv.ExceptionTypeKey.String(entry.PanicType),
+		semconv.ExceptionMessageKey.String(entry.PanicValue),
+		semconv.ExceptionStacktraceKey.String(entry.Cause),
+		semconv.ExceptionEscapedKey.Bool(c.ThrowPanic),
+	))
+	span.SetStatus(codes.Error, entry.PanicValue)
+}
@@ -0,0 +1,82 @@
+package ject
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordingSpan 记录事件和状态的 span
+type recordingSpan struct {
+	trace.Span
+
+	mu     sync.Mutex
+	events map[string][]attribute.KeyValue
+	code   codes.Code
+	desc   string
+}
+
+func (s *recordingSpan) IsRecording() bool { return true }
+
+func (s *recordingSpan) AddEvent(name string, options ...trace.EventOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[name] = trace.NewEventConfig(options...).Attributes
+}
+
+func (s *recordingSpan) SetStatus(code codes.Code, desc string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.code, s.desc = code, desc
+}
+
+func TestRecordSpan(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+	span := &recordingSpan{Span: trace.SpanFromContext(trace.ContextWithSpanContext(context.Background(), sc)), events: map[string][]attribute.KeyValue{}}
+
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false))
+	cj.AddHook(hook)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(trace.ContextWithSpan(c.Request.Context(), span))
+	}, RecoveryHandlerFunc(cj))
+	engine.GET("/", func(c *gin.Context) {
+		panic("traced")
+	})
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	entry := hook.entries[0]
+	if entry.TraceID != traceID.String() || entry.SpanID != spanID.String() {
+		t.Fatalf("trace_id=%q span_id=%q", entry.TraceID, entry.SpanID)
+	}
+	if entry.Ctx.Err() != nil {
+		t.Fatalf("entry context should not be canceled: %v", entry.Ctx.Err())
+	}
+
+	attrs := attribute.NewSet(span.events[semconv.ExceptionEventName]...)
+	if v, _ := attrs.Value(semconv.ExceptionTypeKey); v.AsString() != "string" {
+		t.Fatalf("exception.type = %q", v.AsString())
+	}
+	if v, _ := attrs.Value(semconv.ExceptionMessageKey); v.AsString() != "traced" {
+		t.Fatalf("exception.message = %q", v.AsString())
+	}
+	if v, _ := attrs.Value(semconv.ExceptionStacktraceKey); v.AsString() != entry.Cause {
+		t.Fatal("exception.stacktrace should be the rendered stack")
+	}
+	if span.code != codes.Error || span.desc != "traced" {
+		t.Fatalf("status = %v %q", span.code, span.desc)
+	}
+}
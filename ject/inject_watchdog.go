@@ -0,0 +1,279 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const _defaultWatchdogStackBytes = 4 << 20 // 检测时默认最多使用 4MB 获取所有协程的栈
+
+// WatchdogConfig 卡住请求的检测配置
+type WatchdogConfig struct {
+	Threshold     time.Duration // 请求执行超过这个时间时报告, 小于等于 0 时不检测
+	Interval      time.Duration // 检查的间隔, 默认是 Threshold 的一半
+	MaxStackBytes int64         // 获取所有协程的栈时最多使用的字节数, 超过时截断, 截断后找不到处理协程的栈时仍然报告, 默认 4MB
+}
+
+// 设置卡住请求的检测, 需要同时使用 WatchdogHandlerFunc 中间件
+func SetWatchdog(cfg WatchdogConfig) InjectOption {
+	return func(c *Inject) {
+		if cfg.Threshold <= 0 {
+			c.watchdog = nil
+			return
+		}
+		if cfg.Interval <= 0 {
+			cfg.Interval = cfg.Threshold / 2
+		}
+		if cfg.MaxStackBytes <= 0 {
+			cfg.MaxStackBytes = _defaultWatchdogStackBytes
+		}
+		c.watchdog = &watchdog{
+			cfg:      cfg,
+			inflight: make(map[uint64]*inflightRequest),
+			done:     make(chan struct{}),
+		}
+	}
+}
+
+// WatchdogHandlerFunc 记录正在执行的请求, 请求执行超过阈值时把处理协程的栈报告给钩子, 每个请求只报告一次
+// 放在 RecoveryHandlerFunc 之后时, 报告可以带上面包屑
+func WatchdogHandlerFunc(cj *Inject) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		if cj.watchdog == nil {
+			c.Next()
+			return
+		}
+
+		id := cj.watchdog.track(cj.inflightRequest(c))
+		defer cj.watchdog.untrack(id)
+		c.Next()
+	}
+}
+
+// inflightRequest 正在执行的请求, 请求相关的信息在请求开始时读取, 避免与处理协程竞争
+type inflightRequest struct {
+	goroutine uint64
+	start     time.Time
+	ctx       context.Context
+	requestID string
+	uri       string
+	method    string
+	remote    string
+	clientIP  string
+	userAgent string
+	route     string
+	handler   string
+	reported  bool
+}
+
+func (c *Inject) inflightRequest(gc *gin.Context) *inflightRequest {
+	r := gc.Request
+	return &inflightRequest{
+		goroutine: goroutineID(),
+		start:     time.Now(),
+		ctx:       r.Context(),
+		requestID: c.GetRequestID(r),
+		uri:       c.redactor.RedactURI(r.RequestURI),
+		method:    r.Method,
+		remote:    r.RemoteAddr,
+		clientIP:  gc.ClientIP(),
+		userAgent: r.UserAgent(),
+		route:     gc.FullPath(),
+		handler:   gc.HandlerName(),
+	}
+}
+
+// watchdog 定时检查正在执行的请求
+type watchdog struct {
+	cfg WatchdogConfig
+
+	mu       sync.Mutex
+	seq      uint64
+	inflight map[uint64]*inflightRequest
+
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup // 检查协程和同步模式下投递报告的协程
+}
+
+func (w *watchdog) track(req *inflightRequest) uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.seq++
+	w.inflight[w.seq] = req
+	return w.seq
+}
+
+func (w *watchdog) untrack(id uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.inflight, id)
+}
+
+// 在后台定时检查, report 在检查协程中调用
+func (w *watchdog) start(report func(req *inflightRequest, stack string)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case now := <-ticker.C:
+				w.scan(now, report)
+			}
+		}
+	}()
+}
+
+// 找出超过阈值并且还没有报告过的请求, 从所有协程的栈中找到处理协程的栈
+func (w *watchdog) scan(now time.Time, report func(req *inflightRequest, stack string)) {
+	var overdue []*inflightRequest
+	w.mu.Lock()
+	for _, req := range w.inflight {
+		if !req.reported && now.Sub(req.start) >= w.cfg.Threshold {
+			req.reported = true
+			overdue = append(overdue, req)
+		}
+	}
+	w.mu.Unlock()
+
+	if len(overdue) == 0 {
+		return
+	}
+
+	dump := allStacks(w.cfg.MaxStackBytes)
+	truncated := int64(len(dump)) >= w.cfg.MaxStackBytes
+	stacks := goroutineStacks(dump)
+	for _, req := range overdue {
+		stack, ok := stacks[req.goroutine]
+		switch {
+		case ok:
+			report(req, stack)
+		case truncated:
+			// 协程太多, 处理协程的栈在截断的部分之后, 仍然报告, 只是没有栈
+			report(req, fmt.Sprintf("goroutine %d [unknown]:\n...[stack truncated, dump of all goroutines exceeds %d bytes]\n", req.goroutine, w.cfg.MaxStackBytes))
+		}
+		// 没有截断又找不到栈说明请求刚好结束了
+	}
+}
+
+func (w *watchdog) stop(ctx context.Context) error {
+	w.once.Do(func() { close(w.done) })
+
+	finished := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 构造卡住请求的报告并投递给钩子, 在检查协程中调用, 不能被钩子阻塞
+func (c *Inject) reportStuck(req *inflightRequest, stack string) {
+	entry := c.NewEntry(req.ctx, nil, stack)
+	entry.Kind = KindStuck
+	if req.requestID != "" {
+		entry.RequestID = req.requestID
+	}
+	entry.RequestURI = req.uri
+	entry.Method = req.method
+	entry.RemoteAddr = req.remote
+	entry.ClientIP = req.clientIP
+	entry.UserAgent = req.userAgent
+	entry.Route = req.route
+	entry.Handler = req.handler
+	entry.Elapsed = time.Since(req.start).String()
+	entry.Size = _noWritten
+	entry.Data["goroutine_id"] = req.goroutine
+	entry.Fingerprint = fingerprint(fmt.Sprintf("%s %s %s %s", KindStuck, req.method, req.route, topFunction(stack)), nil)
+	c.attachBreadcrumbs(entry)
+	if c.runtimeSnapshot {
+		entry.Runtime = c.snapshot()
+	}
+
+	if !c.admit(entry) {
+		return
+	}
+	// 异步模式下队列满时直接丢弃, 同步模式下在新的协程中调用钩子, Shutdown 会等待这些协程
+	if c.dispatcher != nil {
+		if err := c.dispatcher.offer(entry); err != nil {
+			reportDropped(entry, err)
+		}
+		return
+	}
+	c.watchdog.wg.Add(1)
+	go func() {
+		defer c.watchdog.wg.Done()
+		c.fireHooks(entry)
+	}()
+}
+
+// 当前协程的 ID, 从栈的第一行解析: goroutine 18 [running]:
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	id, _ := parseGoroutineHeader(string(buf))
+	return id
+}
+
+func parseGoroutineHeader(line string) (uint64, bool) {
+	if !strings.HasPrefix(line, "goroutine ") {
+		return 0, false
+	}
+	line = line[len("goroutine "):]
+	if idx := strings.IndexByte(line, ' '); idx > 0 {
+		line = line[:idx]
+	}
+	id, err := strconv.ParseUint(line, 10, 64)
+	return id, err == nil
+}
+
+// 把所有协程的栈按照协程 ID 拆分
+func goroutineStacks(dump []byte) map[uint64]string {
+	stacks := make(map[uint64]string)
+	for _, block := range bytes.Split(dump, []byte("\n\n")) {
+		if id, ok := parseGoroutineHeader(string(block)); ok {
+			stacks[id] = string(block) + "\n"
+		}
+	}
+	return stacks
+}
+
+// 栈中最顶层的函数, 用于计算指纹
+func topFunction(stack string) string {
+	lines := strings.SplitN(stack, "\n", 3)
+	if len(lines) < 2 {
+		return ""
+	}
+	fn := lines[1]
+	if idx := strings.LastIndexByte(fn, '('); idx > 0 {
+		fn = fn[:idx]
+	}
+	return fn
+}
@@ -0,0 +1,171 @@
+package ject
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWatchdogReportsStuckRequest(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetWatchdog(WatchdogConfig{Threshold: 50 * time.Millisecond, Interval: 10 * time.Millisecond}))
+	cj.AddHook(hook)
+
+	var mu sync.Mutex
+	mu.Lock()
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(RecoveryHandlerFunc(cj), WatchdogHandlerFunc(cj))
+	engine.GET("/lock/:id", func(c *gin.Context) {
+		mu.Lock()
+		defer mu.Unlock()
+	})
+	engine.GET("/fast", func(c *gin.Context) {})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r := httptest.NewRequest(http.MethodGet, "/lock/1?token=secret", nil)
+		r.Header.Set(requestID, "stuck-1")
+		engine.ServeHTTP(httptest.NewRecorder(), r)
+	}()
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+
+	for i := 0; i < 100 && hook.count() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 多等几个检查周期, 同一个请求只报告一次
+	time.Sleep(50 * time.Millisecond)
+	mu.Unlock()
+	<-done
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := cj.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if hook.count() != 1 {
+		t.Fatalf("delivered %d entries, want 1", hook.count())
+	}
+	e := hook.entries[0]
+	if e.Kind != KindStuck || e.Route != "/lock/:id" || e.RequestURI != "/lock/1?token=******" || e.RequestID != "stuck-1" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if !strings.Contains(e.Cause, "sync.(*Mutex).Lock") || !strings.Contains(e.Cause, "TestWatchdogReportsStuckRequest") {
+		t.Fatalf("stack should belong to the handler goroutine:\n%s", e.Cause)
+	}
+	if !strings.HasPrefix(e.Cause, "goroutine ") || strings.Contains(e.Cause, "\ngoroutine ") {
+		t.Fatalf("stack should contain only one goroutine:\n%s", e.Cause)
+	}
+}
+
+func TestGoroutineStacks(t *testing.T) {
+	dump := "goroutine 1 [running]:\nmain.main()\n\t/app/main.go:10 +0x1d\n\ngoroutine 42 [sync.Mutex.Lock, 2 minutes]:\nsync.runtime_SemacquireMutex(0xc000010000?, 0x0?, 0x1?)\n\t/go/src/runtime/sema.go:77 +0x25\n"
+	stacks := goroutineStacks([]byte(dump))
+	if len(stacks) != 2 || !strings.HasPrefix(stacks[42], "goroutine 42 [sync.Mutex.Lock, 2 minutes]:") {
+		t.Fatalf("stacks = %q", stacks)
+	}
+	if fn := topFunction(stacks[42]); fn != "sync.runtime_SemacquireMutex" {
+		t.Fatalf("top function = %q", fn)
+	}
+	if id := goroutineID(); id == 0 {
+		t.Fatal("goroutine id should be parsed")
+	}
+}
+
+func TestWatchdogSlowHookDoesNotBlockScan(t *testing.T) {
+	release := make(chan struct{})
+	fired := make(chan string, 2)
+	cj := NewInject(SetAsync(false), SetDedupWindow(0), SetWatchdog(WatchdogConfig{Threshold: 30 * time.Millisecond, Interval: 10 * time.Millisecond}))
+	cj.AddHook(HookFunc(func(ctx context.Context, entry *Entry) error {
+		fired <- entry.Route
+		<-release
+		return nil
+	}))
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(WatchdogHandlerFunc(cj))
+	engine.GET("/a", func(c *gin.Context) { <-release })
+	engine.GET("/b", func(c *gin.Context) { <-release })
+
+	var wg sync.WaitGroup
+	serve := func(path string) {
+		defer wg.Done()
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	wg.Add(1)
+	go serve("/a")
+	// 第一个报告阻塞在钩子里之后, 第二个卡住的请求仍然要被报告
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("first stuck request was not reported")
+	}
+	wg.Add(1)
+	go serve("/b")
+	select {
+	case route := <-fired:
+		if route != "/b" {
+			t.Fatalf("second report route = %q", route)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a slow hook blocked the watchdog")
+	}
+
+	close(release)
+	wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := cj.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchdogReportsWhenStackDumpTruncated(t *testing.T) {
+	hook := &countHook{}
+	cj := NewInject(SetAsync(false), SetWatchdog(WatchdogConfig{Threshold: 20 * time.Millisecond, Interval: 5 * time.Millisecond, MaxStackBytes: 8 << 10}))
+	cj.AddHook(hook)
+
+	// 大量空闲的协程把处理协程的栈挤出 8KB 的上限
+	idle := make(chan struct{})
+	for i := 0; i < 200; i++ {
+		go func() { <-idle }()
+	}
+	defer close(idle)
+
+	release := make(chan struct{})
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(WatchdogHandlerFunc(cj))
+	engine.GET("/stuck", func(c *gin.Context) { <-release })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stuck", nil))
+	}()
+
+	for i := 0; i < 200 && hook.count() == 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(release)
+	<-done
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = cj.Shutdown(ctx)
+
+	if hook.count() != 1 {
+		t.Fatalf("delivered %d entries, want 1", hook.count())
+	}
+	if e := hook.entries[0]; e.Kind != KindStuck || e.Route != "/stuck" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+}
@@ -5,9 +5,174 @@
 
 package ject
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+var (
+	// ErrHookExists 注册的钩子名字已经存在时返回
+	ErrHookExists = errors.New("ject: hook name already exists")
+	// ErrHookInvalid 钩子名字为空或者钩子为 nil 时返回
+	ErrHookInvalid = errors.New("ject: hook name is empty or hook is nil")
+)
 
 // 回调接口 interface
 type Hook interface {
 	Fire(ctx context.Context, entry *Entry) error
 }
+
+// NamedHook 带名字的钩子, 用于 ReplaceHooks
+type NamedHook struct {
+	Name string
+	Hook Hook
+}
+
+// hookSlot 注册的钩子, 名字用于删除, 启停和死信重放
+type hookSlot struct {
+	name     string
+	named    bool // 是否显式指定了名字, 只有显式命名的钩子才写入死信
+	hook     Hook
+	disabled int32      // 是否停用, 原子读写
+	stats    *hookStats // 调用统计
+}
+
+func newHookSlot(name string, named bool, h Hook) *hookSlot {
+	return &hookSlot{name: name, named: named, hook: h, stats: newHookStats()}
+}
+
+func (s *hookSlot) enabled() bool {
+	return atomic.LoadInt32(&s.disabled) == 0
+}
+
+// 当前注册的钩子, 读取时不加锁, 修改时复制一份新的切片整体替换
+func (c *Inject) loadHooks() []*hookSlot {
+	slots, _ := c.hooks.Load().([]*hookSlot)
+	return slots
+}
+
+// AddHook 注册钩子, 名字取钩子的类型, 重名时追加序号
+// 这样的名字依赖注册顺序, 重启之后可能对应到其他钩子, 所以投递失败的报告不写入死信, 需要死信时使用 AddNamedHook
+func (c *Inject) AddHook(h Hook) {
+	if h == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	slots := c.loadHooks()
+	base := fmt.Sprintf("%T", h)
+	name := base
+	for i := 2; indexHook(slots, name) >= 0; i++ {
+		name = fmt.Sprintf("%s#%d", base, i)
+	}
+	c.storeHooks(append(copyHooks(slots), newHookSlot(name, false, h)))
+}
+
+// AddNamedHook 以指定的名字注册钩子, 名字已经存在时返回 ErrHookExists
+func (c *Inject) AddNamedHook(name string, h Hook) error {
+	if name == "" || h == nil {
+		return ErrHookInvalid
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	slots := c.loadHooks()
+	if indexHook(slots, name) >= 0 {
+		return ErrHookExists
+	}
+	c.storeHooks(append(copyHooks(slots), newHookSlot(name, true, h)))
+	return nil
+}
+
+// RemoveHook 删除钩子, 返回钩子是否存在, 正在执行的投递不受影响
+func (c *Inject) RemoveHook(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	slots := c.loadHooks()
+	idx := indexHook(slots, name)
+	if idx < 0 {
+		return false
+	}
+
+	next := make([]*hookSlot, 0, len(slots)-1)
+	next = append(next, slots[:idx]...)
+	next = append(next, slots[idx+1:]...)
+	c.storeHooks(next)
+	return true
+}
+
+// ReplaceHooks 原子地替换所有钩子, 名字为空, 重名或者钩子为 nil 时不做任何修改
+func (c *Inject) ReplaceHooks(hooks ...NamedHook) error {
+	next := make([]*hookSlot, 0, len(hooks))
+	for _, v := range hooks {
+		if v.Name == "" || v.Hook == nil {
+			return ErrHookInvalid
+		}
+		if indexHook(next, v.Name) >= 0 {
+			return ErrHookExists
+		}
+		next = append(next, newHookSlot(v.Name, true, v.Hook))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.storeHooks(next)
+	return nil
+}
+
+// EnableHook 启用钩子, 返回钩子是否存在
+func (c *Inject) EnableHook(name string) bool {
+	return c.setHookDisabled(name, 0)
+}
+
+// DisableHook 停用钩子, 停用期间的报告不会投递给这个钩子, 返回钩子是否存在
+func (c *Inject) DisableHook(name string) bool {
+	return c.setHookDisabled(name, 1)
+}
+
+func (c *Inject) setHookDisabled(name string, disabled int32) bool {
+	slots := c.loadHooks()
+	idx := indexHook(slots, name)
+	if idx < 0 {
+		return false
+	}
+	atomic.StoreInt32(&slots[idx].disabled, disabled)
+	return true
+}
+
+// HookNames 按照注册顺序返回所有钩子的名字
+func (c *Inject) HookNames() []string {
+	slots := c.loadHooks()
+	names := make([]string, 0, len(slots))
+	for _, s := range slots {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// 调用时持有 mu
+func (c *Inject) storeHooks(slots []*hookSlot) {
+	c.hooks.Store(slots)
+	c.replayPending(slots)
+}
+
+func copyHooks(slots []*hookSlot) []*hookSlot {
+	next := make([]*hookSlot, len(slots), len(slots)+1)
+	copy(next, slots)
+	return next
+}
+
+func indexHook(slots []*hookSlot, name string) int {
+	for i, s := range slots {
+		if s.name == name {
+			return i
+		}
+	}
+	return -1
+}
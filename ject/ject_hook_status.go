@@ -0,0 +1,140 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 钩子耗时直方图的分桶上限, 最后还有一个不限上限的桶
+var hookLatencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// HookStatus 钩子的健康状态, 每次调用钩子都计为一次尝试, 包括重试
+type HookStatus struct {
+	Name            string          `json:"name"`                        // 钩子的名字
+	Enabled         bool            `json:"enabled"`                     // 是否启用
+	Attempts        uint64          `json:"attempts"`                    // 调用次数
+	Successes       uint64          `json:"successes"`                   // 成功次数
+	Failures        uint64          `json:"failures"`                    // 失败次数
+	LastError       string          `json:"last_error,omitempty"`        // 最近一次的错误
+	LastErrorTime   string          `json:"last_error_time,omitempty"`   // 最近一次失败的时间
+	LastSuccessTime string          `json:"last_success_time,omitempty"` // 最近一次成功的时间
+	Latency         []LatencyBucket `json:"latency"`                     // 耗时直方图
+}
+
+// LatencyBucket 耗时直方图的一个分桶, 统计耗时不超过 Le 并且大于上一个分桶的调用次数
+type LatencyBucket struct {
+	Le    string `json:"le"` // 分桶上限, 最后一个分桶是 +Inf
+	Count uint64 `json:"count"`
+}
+
+// hookStats 单个钩子的调用统计
+type hookStats struct {
+	mu          sync.Mutex
+	attempts    uint64
+	successes   uint64
+	failures    uint64
+	lastError   string
+	lastErrorAt time.Time
+	lastSuccess time.Time
+	latency     []uint64
+}
+
+func newHookStats() *hookStats {
+	return &hookStats{latency: make([]uint64, len(hookLatencyBuckets)+1)}
+}
+
+// 记录一次调用的结果和耗时
+func (s *hookStats) observe(start time.Time, err error) {
+	now := time.Now()
+	elapsed := now.Sub(start)
+
+	idx := len(hookLatencyBuckets)
+	for i, bound := range hookLatencyBuckets {
+		if elapsed <= bound {
+			idx = i
+			break
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts++
+	s.latency[idx]++
+	if err != nil {
+		s.failures++
+		s.lastError = err.Error()
+		s.lastErrorAt = now
+		return
+	}
+	s.successes++
+	s.lastSuccess = now
+}
+
+// HookStatus 按照注册顺序返回所有钩子的健康状态
+func (c *Inject) HookStatus() []HookStatus {
+	slots := c.loadHooks()
+	statuses := make([]HookStatus, 0, len(slots))
+	for _, slot := range slots {
+		statuses = append(statuses, c.hookStatus(slot))
+	}
+	return statuses
+}
+
+func (c *Inject) hookStatus(slot *hookSlot) HookStatus {
+	s := slot.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := HookStatus{
+		Name:      slot.name,
+		Enabled:   slot.enabled(),
+		Attempts:  s.attempts,
+		Successes: s.successes,
+		Failures:  s.failures,
+		LastError: s.lastError,
+		Latency:   make([]LatencyBucket, 0, len(s.latency)),
+	}
+	if !s.lastErrorAt.IsZero() {
+		status.LastErrorTime = c.TimeFormatter(s.lastErrorAt)
+	}
+	if !s.lastSuccess.IsZero() {
+		status.LastSuccessTime = c.TimeFormatter(s.lastSuccess)
+	}
+	for i, count := range s.latency {
+		le := "+Inf"
+		if i < len(hookLatencyBuckets) {
+			le = hookLatencyBuckets[i].String()
+		}
+		status.Latency = append(status.Latency, LatencyBucket{Le: le, Count: count})
+	}
+
+	return status
+}
+
+// HookStatusHandler 以 JSON 格式返回所有钩子的健康状态
+func HookStatusHandler(cj *Inject) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"hooks": cj.HookStatus()})
+	}
+}
+
+// RegisterHookStatus 把钩子的健康状态挂载到路由上, 比如: RegisterHookStatus(engine.Group("/debug"), "/hooks", cj)
+func RegisterHookStatus(r gin.IRoutes, path string, cj *Inject) {
+	r.GET(path, HookStatusHandler(cj))
+}
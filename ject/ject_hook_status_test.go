@@ -0,0 +1,59 @@
+package ject
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/laxiaohong/agave/encoding/json"
+)
+
+func TestHookStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cj := NewInject(SetAsync(false), SetDedupWindow(0), SetRetryPolicy(RetryPolicy{MaxAttempts: 2}))
+	_ = cj.AddNamedHook("ok", &countHook{})
+	_ = cj.AddNamedHook("broken", HookFunc(func(ctx context.Context, entry *Entry) error {
+		return errors.New("wechat unavailable")
+	}))
+	cj.DisableHook("ok")
+	cj.dispatch(&Entry{Ctx: context.Background()})
+	cj.EnableHook("ok")
+	cj.dispatch(&Entry{Ctx: context.Background()})
+
+	engine := gin.New()
+	RegisterHookStatus(engine.Group("/debug"), "/hooks", cj)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/hooks", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	var body struct {
+		Hooks []HookStatus `json:"hooks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Hooks) != 2 {
+		t.Fatalf("hooks = %+v", body.Hooks)
+	}
+
+	ok, broken := body.Hooks[0], body.Hooks[1]
+	if !ok.Enabled || ok.Attempts != 1 || ok.Successes != 1 || ok.LastSuccessTime == "" || ok.LastError != "" {
+		t.Fatalf("ok = %+v", ok)
+	}
+	if broken.Attempts != 4 || broken.Failures != 4 || broken.LastError != "wechat unavailable" || broken.LastSuccessTime != "" {
+		t.Fatalf("broken = %+v", broken)
+	}
+
+	var total uint64
+	for _, b := range broken.Latency {
+		total += b.Count
+	}
+	if total != 4 || broken.Latency[len(broken.Latency)-1].Le != "+Inf" {
+		t.Fatalf("latency = %+v", broken.Latency)
+	}
+}
@@ -0,0 +1,173 @@
+package ject
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHookNames(t *testing.T) {
+	cj := NewInject(SetAsync(false))
+	cj.AddHook(&countHook{})
+	cj.AddHook(&countHook{})
+	if err := cj.AddNamedHook("wechat", &countHook{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cj.AddNamedHook("wechat", &countHook{}); err != ErrHookExists {
+		t.Fatalf("duplicate name err = %v", err)
+	}
+	if err := cj.AddNamedHook("", &countHook{}); err != ErrHookInvalid {
+		t.Fatalf("empty name err = %v", err)
+	}
+
+	want := []string{"*ject.countHook", "*ject.countHook#2", "wechat"}
+	if got := cj.HookNames(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("names = %v, want %v", got, want)
+	}
+
+	if !cj.RemoveHook("*ject.countHook#2") || cj.RemoveHook("missing") {
+		t.Fatal("unexpected RemoveHook result")
+	}
+	if got := cj.HookNames(); !reflect.DeepEqual(got, []string{"*ject.countHook", "wechat"}) {
+		t.Fatalf("names after remove = %v", got)
+	}
+}
+
+func TestReplaceAndDisableHooks(t *testing.T) {
+	cj := NewInject(SetAsync(false), SetDedupWindow(0))
+	old, a, b := &countHook{}, &countHook{}, &countHook{}
+	cj.AddHook(old)
+
+	if err := cj.ReplaceHooks(NamedHook{"a", a}, NamedHook{"a", b}); err != ErrHookExists {
+		t.Fatalf("duplicate replace err = %v", err)
+	}
+	if err := cj.ReplaceHooks(NamedHook{"a", a}, NamedHook{"b", b}); err != nil {
+		t.Fatal(err)
+	}
+	if !cj.DisableHook("b") {
+		t.Fatal("hook b should exist")
+	}
+
+	cj.dispatch(&Entry{Ctx: context.Background()})
+	if old.count() != 0 || a.count() != 1 || b.count() != 0 {
+		t.Fatalf("old=%d a=%d b=%d", old.count(), a.count(), b.count())
+	}
+
+	cj.EnableHook("b")
+	cj.dispatch(&Entry{Ctx: context.Background()})
+	if a.count() != 2 || b.count() != 1 {
+		t.Fatalf("a=%d b=%d", a.count(), b.count())
+	}
+}
+
+func TestHooksConcurrentModify(t *testing.T) {
+	cj := NewInject(SetQueueSize(1024), SetDedupWindow(0))
+	hook := &countHook{}
+	if err := cj.AddNamedHook("stable", hook); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			cj.dispatch(&Entry{Ctx: context.Background()})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			_ = cj.AddNamedHook("temp", &countHook{})
+			cj.DisableHook("temp")
+			cj.RemoveHook("temp")
+		}
+	}()
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := cj.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := hook.count(); got != 200 {
+		t.Fatalf("stable hook received %d entries, want 200", got)
+	}
+}
+
+func TestSpoolReplayByName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ject-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	policy := SetRetryPolicy(RetryPolicy{MaxAttempts: 1, BaseDelay: time.Millisecond})
+	cj := NewInject(SetAsync(false), SetSpoolDir(dir), policy)
+	if err = cj.AddNamedHook("primary", &flakyHook{fail: 1}); err != nil {
+		t.Fatal(err)
+	}
+	cj.dispatch(&Entry{Ctx: context.Background(), RequestID: "by-name", Data: map[string]interface{}{}})
+
+	// 同类型的钩子以其他名字注册时不会收到死信, 以原来的名字注册之后自动重放
+	other, primary := &flakyHook{}, &flakyHook{}
+	restarted := NewInject(SetAsync(false), SetSpoolDir(dir), policy)
+	_ = restarted.AddNamedHook("other", other)
+	time.Sleep(20 * time.Millisecond)
+	if got := other.delivered(); len(got) != 0 {
+		t.Fatalf("other=%v", got)
+	}
+
+	_ = restarted.AddNamedHook("primary", primary)
+	waitDelivered(t, primary, "by-name")
+	if got := other.delivered(); len(got) != 0 {
+		t.Fatalf("other=%v", got)
+	}
+}
+
+func TestSpoolReplayAfterReplaceHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ject-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	policy := SetRetryPolicy(RetryPolicy{MaxAttempts: 1, BaseDelay: time.Millisecond})
+	cj := NewInject(SetAsync(false), SetSpoolDir(dir), policy)
+	_ = cj.ReplaceHooks(NamedHook{Name: "a", Hook: &flakyHook{fail: 1}}, NamedHook{Name: "b", Hook: &flakyHook{fail: 1}})
+	cj.dispatch(&Entry{Ctx: context.Background(), RequestID: "replace", Data: map[string]interface{}{}})
+
+	// 第二个实例先注册 a, 之后再注册 b, 两个钩子都能收到各自的死信
+	a, b := &flakyHook{}, &flakyHook{}
+	restarted := NewInject(SetAsync(false), SetSpoolDir(dir), policy)
+	if err = restarted.ReplaceHooks(NamedHook{Name: "a", Hook: a}); err != nil {
+		t.Fatal(err)
+	}
+	waitDelivered(t, a, "replace")
+	if err = restarted.AddNamedHook("b", b); err != nil {
+		t.Fatal(err)
+	}
+	waitDelivered(t, b, "replace")
+	if got := a.delivered(); len(got) != 1 {
+		t.Fatalf("a=%v", got)
+	}
+}
+
+func waitDelivered(t *testing.T, h *flakyHook, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := h.delivered(); len(got) > 0 {
+			if len(got) != 1 || got[0] != want {
+				t.Fatalf("delivered=%v, want [%s]", got, want)
+			}
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("spooled entry %q was not replayed", want)
+}
@@ -0,0 +1,301 @@
+// @desc:   gin 崩溃拦截器, 主要用于报告程序 panic 的具体信息
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package ject
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	_maxStuckCalls = 8  // WithTimeout 中超时之后仍在执行的调用的最大数量
+	_maxAsyncCalls = 64 // Async 中同时执行的调用的最大数量
+)
+
+// ErrHookStuck 钩子超时之后仍在执行的调用过多时返回, 此时不再调用钩子
+var ErrHookStuck = errors.New("ject: too many timed out hook calls still running")
+
+// HookFunc 把普通函数转换成钩子
+type HookFunc func(ctx context.Context, entry *Entry) error
+
+func (f HookFunc) Fire(ctx context.Context, entry *Entry) error {
+	return f(ctx, entry)
+}
+
+// HookPanicError 钩子自身 panic 时返回的错误
+type HookPanicError struct {
+	Value interface{} // panic 的值
+	Stack string      // 钩子 panic 时的栈
+}
+
+func (e *HookPanicError) Error() string {
+	return fmt.Sprintf("ject: hook panic: %v", e.Value)
+}
+
+// 调用钩子, 把钩子自身的 panic 转换成错误, 避免在 recover 的 defer 中再次 panic 导致进程退出
+func safeFire(ctx context.Context, h Hook, entry *Entry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &HookPanicError{Value: r, Stack: string(debug.Stack())}
+		}
+	}()
+
+	return h.Fire(ctx, entry)
+}
+
+// WithTimeout 限制钩子的执行时间, 超时之后立即返回错误, 钩子本身仍然可以通过 ctx 感知超时, d 小于等于 0 时不限制
+// 不理会 ctx 的钩子在超时之后会继续执行到返回为止, 这样的调用超过 8 个时直接返回 ErrHookStuck, 不再启动新的协程
+func WithTimeout(h Hook, d time.Duration) Hook {
+	return &timeoutHook{hook: h, timeout: d}
+}
+
+type timeoutHook struct {
+	hook    Hook
+	timeout time.Duration
+	stuck   int32 // 超时之后仍在执行的调用数量, 原子读写
+}
+
+func (t *timeoutHook) Fire(ctx context.Context, entry *Entry) error {
+	if t.timeout <= 0 {
+		return safeFire(ctx, t.hook, entry)
+	}
+	if atomic.LoadInt32(&t.stuck) >= _maxStuckCalls {
+		return fmt.Errorf("ject: hook %T: %w", t.hook, ErrHookStuck)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	// 超时时调用还没有返回则计入 stuck, 由调用的协程在返回之后减去
+	var state int32 // 0: 执行中, 1: 已超时, 2: 已返回
+	done := make(chan error, 1)
+	go func() {
+		err := safeFire(ctx, t.hook, entry)
+		if !atomic.CompareAndSwapInt32(&state, 0, 2) {
+			atomic.AddInt32(&t.stuck, -1)
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if atomic.CompareAndSwapInt32(&state, 0, 1) {
+			atomic.AddInt32(&t.stuck, 1)
+		}
+		return fmt.Errorf("ject: hook %T: %w", t.hook, ctx.Err())
+	}
+}
+
+// When 只有 predicate 返回 true 时才调用钩子, 比如只通知 POST /pay 的崩溃
+func When(predicate func(entry *Entry) bool, h Hook) Hook {
+	return &condHook{hook: h, predicate: predicate}
+}
+
+type condHook struct {
+	hook      Hook
+	predicate func(entry *Entry) bool
+}
+
+func (c *condHook) Fire(ctx context.Context, entry *Entry) error {
+	if !c.predicate(entry) {
+		return nil
+	}
+	return safeFire(ctx, c.hook, entry)
+}
+
+// Fallback primary 失败时调用 secondary, 比如微信通知失败时写入文件
+func Fallback(primary, secondary Hook) Hook {
+	return &fallbackHook{primary: primary, secondary: secondary}
+}
+
+type fallbackHook struct {
+	primary   Hook
+	secondary Hook
+}
+
+func (f *fallbackHook) Fire(ctx context.Context, entry *Entry) error {
+	err := safeFire(ctx, f.primary, entry)
+	if err == nil {
+		return nil
+	}
+
+	if serr := safeFire(ctx, f.secondary, entry); serr != nil {
+		return MultiError{err, serr}
+	}
+	return nil
+}
+
+// Multi 依次调用所有钩子, 某个钩子失败不影响后面的钩子, 返回所有的错误
+func Multi(hooks ...Hook) Hook {
+	return multiHook(hooks)
+}
+
+type multiHook []Hook
+
+func (m multiHook) Fire(ctx context.Context, entry *Entry) error {
+	var errs MultiError
+	for _, h := range m {
+		if err := safeFire(ctx, h, entry); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// MultiError 多个钩子返回的错误
+type MultiError []error
+
+func (m MultiError) Error() string {
+	msgs := make([]string, 0, len(m))
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap 返回所有的错误, Go 1.20 之后 errors.Is 和 errors.As 会逐个检查
+func (m MultiError) Unwrap() []error {
+	return m
+}
+
+// Is 任意一个错误匹配 target 时返回 true, Go 1.20 之前的 errors.Is 通过这个方法检查
+func (m MultiError) Is(target error) bool {
+	for _, err := range m {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As 把第一个匹配 target 类型的错误写入 target, Go 1.20 之前的 errors.As 通过这个方法检查
+func (m MultiError) As(target interface{}) bool {
+	for _, err := range m {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Async 在新的协程中调用钩子, 立即返回, 钩子的错误输出到标准错误
+// 钩子拿到的 ctx 保留原来的值, 但是不会随着请求结束而取消
+// 同时最多执行 64 个调用, 超过时返回 ErrQueueFull, Inject.Shutdown 会等待还在执行的调用
+func Async(h Hook) Hook {
+	return &asyncHook{hook: h, sem: make(chan struct{}, _maxAsyncCalls)}
+}
+
+type asyncHook struct {
+	hook Hook
+	sem  chan struct{} // 限制同时执行的调用数量
+	wg   sync.WaitGroup
+}
+
+func (a *asyncHook) Fire(ctx context.Context, entry *Entry) error {
+	select {
+	case a.sem <- struct{}{}:
+	default:
+		return fmt.Errorf("ject: async hook %T: %w", a.hook, ErrQueueFull)
+	}
+
+	ctx = detach(ctx)
+	a.wg.Add(1)
+	go func() {
+		defer func() {
+			<-a.sem
+			a.wg.Done()
+		}()
+		if err := safeFire(ctx, a.hook, entry); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "ject: async hook %T err:%s\n", a.hook, err)
+		}
+	}()
+	return nil
+}
+
+func (a *asyncHook) drain(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return drainHook(ctx, a.hook)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drainer 在后台调用钩子的装饰器, Shutdown 时等待还在执行的调用
+type drainer interface {
+	drain(ctx context.Context) error
+}
+
+// 等待钩子以及被包装的钩子中还在执行的后台调用
+func drainHook(ctx context.Context, h Hook) error {
+	if d, ok := h.(drainer); ok {
+		return d.drain(ctx)
+	}
+	return nil
+}
+
+func (t *timeoutHook) drain(ctx context.Context) error {
+	return drainHook(ctx, t.hook)
+}
+
+func (c *condHook) drain(ctx context.Context) error {
+	return drainHook(ctx, c.hook)
+}
+
+func (f *fallbackHook) drain(ctx context.Context) error {
+	if err := drainHook(ctx, f.primary); err != nil {
+		return err
+	}
+	return drainHook(ctx, f.secondary)
+}
+
+func (m multiHook) drain(ctx context.Context) error {
+	for _, h := range m {
+		if err := drainHook(ctx, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detachedContext 只保留原来 ctx 中的值, 没有截止时间, 也不会被取消
+type detachedContext struct {
+	parent context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return detachedContext{parent: ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+func (d detachedContext) Value(key interface{}) interface{} { return d.parent.Value(key) }
@@ -0,0 +1,212 @@
+package ject
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHookDecorators(t *testing.T) {
+	ctx := context.Background()
+	failed := HookFunc(func(ctx context.Context, entry *Entry) error {
+		return errors.New("wechat unavailable")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		slow := HookFunc(func(ctx context.Context, entry *Entry) error {
+			<-ctx.Done()
+			return nil
+		})
+		err := WithTimeout(slow, 10*time.Millisecond).Fire(ctx, &Entry{})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+
+	t.Run("no timeout", func(t *testing.T) {
+		hook := HookFunc(func(ctx context.Context, entry *Entry) error {
+			if _, ok := ctx.Deadline(); ok {
+				return errors.New("unexpected deadline")
+			}
+			return nil
+		})
+		for _, d := range []time.Duration{0, -time.Second} {
+			if err := WithTimeout(hook, d).Fire(ctx, &Entry{}); err != nil {
+				t.Fatalf("d=%s err=%v", d, err)
+			}
+		}
+	})
+
+	t.Run("timeout ignored", func(t *testing.T) {
+		release := make(chan struct{})
+		var calls int32
+		stubborn := HookFunc(func(ctx context.Context, entry *Entry) error {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return nil
+		})
+		hook := WithTimeout(stubborn, time.Millisecond)
+		for i := 0; i < _maxStuckCalls; i++ {
+			if err := hook.Fire(ctx, &Entry{}); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("call %d err = %v", i, err)
+			}
+		}
+		if err := hook.Fire(ctx, &Entry{}); !errors.Is(err, ErrHookStuck) {
+			t.Fatalf("err = %v", err)
+		}
+		if got := atomic.LoadInt32(&calls); got != _maxStuckCalls {
+			t.Fatalf("hook called %d times, want %d", got, _maxStuckCalls)
+		}
+
+		// 卡住的调用返回之后恢复调用
+		close(release)
+		deadline := time.Now().Add(time.Second)
+		for atomic.LoadInt32(&hook.(*timeoutHook).stuck) != 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if err := hook.Fire(ctx, &Entry{}); err != nil {
+			t.Fatalf("err = %v", err)
+		}
+	})
+
+	t.Run("when", func(t *testing.T) {
+		hook := &countHook{}
+		pay := When(func(entry *Entry) bool {
+			return entry.Method == http.MethodPost && entry.Route == "/pay"
+		}, hook)
+		_ = pay.Fire(ctx, &Entry{Method: http.MethodGet, Route: "/pay"})
+		_ = pay.Fire(ctx, &Entry{Method: http.MethodPost, Route: "/pay"})
+		if hook.count() != 1 {
+			t.Fatalf("fired %d times, want 1", hook.count())
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		file := &countHook{}
+		if err := Fallback(failed, file).Fire(ctx, &Entry{}); err != nil || file.count() != 1 {
+			t.Fatalf("err=%v fallback fired %d times", err, file.count())
+		}
+		err := Fallback(failed, failed).Fire(ctx, &Entry{})
+		if errs, ok := err.(MultiError); !ok || len(errs) != 2 {
+			t.Fatalf("err = %#v", err)
+		}
+	})
+
+	t.Run("multi error", func(t *testing.T) {
+		broken := HookFunc(func(ctx context.Context, entry *Entry) error {
+			panic("broken")
+		})
+		timeout := HookFunc(func(ctx context.Context, entry *Entry) error {
+			return fmt.Errorf("send: %w", context.DeadlineExceeded)
+		})
+		err := Multi(failed, broken, timeout).Fire(ctx, &Entry{})
+		if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			t.Fatalf("errors.Is on %v", err)
+		}
+		var panicErr *HookPanicError
+		if !errors.As(err, &panicErr) || panicErr.Value != "broken" {
+			t.Fatalf("errors.As on %v", err)
+		}
+		if got := err.(MultiError).Unwrap(); len(got) != 3 {
+			t.Fatalf("Unwrap() = %v", got)
+		}
+	})
+
+	t.Run("multi", func(t *testing.T) {
+		a, b := &countHook{}, &countHook{}
+		err := Multi(a, failed, b).Fire(ctx, &Entry{})
+		if a.count() != 1 || b.count() != 1 || err == nil || !strings.Contains(err.Error(), "wechat unavailable") {
+			t.Fatalf("a=%d b=%d err=%v", a.count(), b.count(), err)
+		}
+	})
+
+	t.Run("async", func(t *testing.T) {
+		done := make(chan error, 1)
+		hook := HookFunc(func(ctx context.Context, entry *Entry) error {
+			done <- ctx.Err()
+			return nil
+		})
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := Async(hook).Fire(canceled, &Entry{}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("async hook got a canceled ctx: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("async hook was not fired")
+		}
+	})
+}
+
+func TestPanickingHook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cj := NewInject(SetAsync(false), SetRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	cj.AddHook(HookFunc(func(ctx context.Context, entry *Entry) error {
+		panic("hook is broken")
+	}))
+	after := &countHook{}
+	cj.AddHook(after)
+
+	engine := gin.New()
+	engine.Use(RecoveryHandlerFunc(cj))
+	engine.GET("/", func(c *gin.Context) {
+		panic("handler is broken")
+	})
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if after.count() != 1 {
+		t.Fatalf("hook after the panicking one fired %d times", after.count())
+	}
+}
+
+func TestAsyncHookBoundedAndDrained(t *testing.T) {
+	release := make(chan struct{})
+	var finished int32
+	slow := HookFunc(func(ctx context.Context, entry *Entry) error {
+		<-release
+		atomic.AddInt32(&finished, 1)
+		return nil
+	})
+
+	cj := NewInject(SetAsync(false))
+	cj.AddHook(When(func(entry *Entry) bool { return true }, Async(slow)))
+	hook := cj.loadHooks()[0].hook
+	for i := 0; i < _maxAsyncCalls; i++ {
+		if err := hook.Fire(context.Background(), &Entry{}); err != nil {
+			t.Fatalf("call %d err = %v", i, err)
+		}
+	}
+	if err := hook.Fire(context.Background(), &Entry{}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("err = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := cj.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown should wait for running async calls, err = %v", err)
+	}
+
+	close(release)
+	if err := cj.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&finished); got != _maxAsyncCalls {
+		t.Fatalf("%d async calls finished, want %d", got, _maxAsyncCalls)
+	}
+}
@@ -12,7 +12,10 @@ import (
 	"time"
 
 	"github.com/go-kratos/kratos/v2/log"
+	"github.com/laxiaohong/agave/crumb"
 	"github.com/laxiaohong/agave/pencil/config"
+	"github.com/laxiaohong/agave/reqid"
+	"github.com/laxiaohong/agave/stamp"
 	"github.com/natefinch/lumberjack"
 	"github.com/spf13/cast"
 	"go.opentelemetry.io/otel/trace"
@@ -128,7 +131,7 @@ func NewCore(cfg *config.Config) (c *Core) {
 			zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.NewMultiWriteSyncer(zapcore.AddSync(os.Stdout)), logLevel), //同时将日志输出到控制台，NewJSONEncoder 是结构化输出
 		)
 	}
-	logger := zap.New(core, zap.AddCaller(), zap.AddCallerSkip(2))
+	logger := zap.New(core, zap.AddCaller(), zap.AddCallerSkip(2), zap.Fields(buildFields()...))
 
 	c = &Core{
 		pool: &sync.Pool{
@@ -172,14 +175,14 @@ type Option func(ctx context.Context) zap.Field
 // opts 是可变参数
 func (c *MiddleEntry) WithContext(ctx context.Context, opts ...Option) *log.Helper {
 
-	field := make([]zap.Field, 0, len(opts)+1)
+	field := make([]zap.Field, 0, len(opts)+2)
 
 	for _, v := range opts {
 		field = append(field, v(ctx))
 	}
 
-	// 默认注入 trace_id
-	field = append(field, zap.String("trace_id", getTraceId(ctx)))
+	// 默认注入 trace_id 和 request_id
+	field = append(field, zap.String("trace_id", getTraceId(ctx)), zap.String("request_id", reqid.FromContext(ctx)))
 
 	return log.NewHelper(&entryCore{
 		ctx:    ctx,
@@ -211,6 +214,9 @@ func (c *entryCore) Log(level log.Level, keyvals ...interface{}) error {
 		fmt.Fprintf(buf, " %s=%v", keyvals[i], keyvals[i+1])
 	}
 
+	// 记录到请求的面包屑中, 请求崩溃时由 ject 附加到报告
+	crumb.Record(c.ctx, crumb.Crumb{Category: crumb.CategoryLog, Level: level.String(), Message: buf.String()})
+
 	switch level {
 	case log.LevelDebug:
 		c.logger.Debug(buf.String(), c.field...)
@@ -242,6 +248,17 @@ func getWriter(filename string, maxBackup, maxAge, maxSize int, compress bool) i
 	}
 }
 
+// 构建信息, 每一行日志都会带上, 方便区分是哪个版本的程序打印的
+func buildFields() []zap.Field {
+	info := stamp.Get()
+	return []zap.Field{
+		zap.String("version", info.Version),
+		zap.String("revision", info.Revision),
+		zap.Bool("dirty", info.Dirty),
+		zap.String("build_time", info.BuildTime),
+	}
+}
+
 // get trace id
 func getTraceId(ctx context.Context) string {
 	var traceID string
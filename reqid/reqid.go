@@ -0,0 +1,192 @@
+// @desc:   请求 ID 中间件, 生成和传递请求 ID, 供 ject, pencil 和 witchy 共用
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package reqid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DefaultHeader = "X-Trace-Id"  // 默认读取和回显的请求头
+	TraceParent   = "traceparent" // W3C Trace Context 请求头, 从中取 trace-id 作为请求 ID
+
+	_maxLength = 128 // 请求头中的请求 ID 的最大长度, 超过时重新生成
+)
+
+// DefaultHeaders 默认依次读取的请求头
+var DefaultHeaders = []string{DefaultHeader, "X-Request-Id", TraceParent}
+
+type ctxKey struct{}
+
+// NewContext 把请求 ID 写入上下文
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext 从上下文中获取请求 ID, 没有时返回空字符串
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Generator 生成请求 ID 的函数
+type Generator func() string
+
+type config struct {
+	headers   []string
+	response  string
+	generator Generator
+}
+
+// Option 中间件的构造项
+type Option func(c *config)
+
+// 设置依次读取的请求头, 读取 traceparent 时取其中的 trace-id
+func WithHeaders(names ...string) Option {
+	return func(c *config) {
+		c.headers = names
+	}
+}
+
+// 设置回显请求 ID 的响应头, 为空时不回显
+func WithResponseHeader(name string) Option {
+	return func(c *config) {
+		c.response = name
+	}
+}
+
+// 设置请求 ID 的生成函数, 默认使用 NewULID
+func WithGenerator(g Generator) Option {
+	return func(c *config) {
+		c.generator = g
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		headers:   DefaultHeaders,
+		response:  DefaultHeader,
+		generator: NewULID,
+	}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		opt(c)
+	}
+	return c
+}
+
+// 从请求头中读取请求 ID, 都没有时生成新的请求 ID
+func (c *config) resolve(h http.Header) string {
+	for _, name := range c.headers {
+		v := strings.TrimSpace(h.Get(name))
+		if strings.EqualFold(name, TraceParent) {
+			v = traceIDFromParent(v)
+		}
+		if valid(v) {
+			return v
+		}
+	}
+	return c.generator()
+}
+
+// Middleware gin 版本的请求 ID 中间件, 需要放在 ject.RecoveryHandlerFunc 和日志中间件之前
+func Middleware(opts ...Option) gin.HandlerFunc {
+	cfg := newConfig(opts)
+
+	return func(c *gin.Context) {
+		id := cfg.resolve(c.Request.Header)
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), id))
+		if cfg.response != "" {
+			c.Header(cfg.response, id)
+		}
+		c.Next()
+	}
+}
+
+// Handler net/http 版本的请求 ID 中间件
+func Handler(next http.Handler, opts ...Option) http.Handler {
+	cfg := newConfig(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := cfg.resolve(r.Header)
+		if cfg.response != "" {
+			w.Header().Set(cfg.response, id)
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// 只接受可见的 ASCII 字符, 防止日志注入
+func valid(id string) bool {
+	if id == "" || len(id) > _maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// 从 traceparent 中取出 trace-id, 格式: version-traceid-parentid-flags
+func traceIDFromParent(v string) string {
+	parts := strings.Split(v, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || parts[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil {
+		return ""
+	}
+	return strings.ToLower(parts[1])
+}
+
+// Crockford base32 字母表
+const _crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID 生成 ULID, 前 48 位是毫秒时间戳, 后 80 位是随机数, 按照时间有序
+func NewULID() string {
+	var id [16]byte
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint16(id[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(ms))
+	_, _ = rand.Read(id[6:])
+
+	// 128 位编码成 26 个字符, 第一个字符只有 3 位
+	out := make([]byte, 26)
+	hi := binary.BigEndian.Uint64(id[0:8])
+	lo := binary.BigEndian.Uint64(id[8:16])
+	for i := 25; i >= 0; i-- {
+		out[i] = _crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// NewW3C 生成与 W3C Trace Context trace-id 兼容的 32 位十六进制请求 ID
+func NewW3C() string {
+	var id [16]byte
+	for {
+		_, _ = rand.Read(id[:])
+		if id != [16]byte{} {
+			return hex.EncodeToString(id[:])
+		}
+	}
+}
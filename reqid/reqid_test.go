@@ -0,0 +1,71 @@
+package reqid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(Middleware(WithHeaders("X-Request-Id", TraceParent), WithResponseHeader("X-Request-Id")))
+	engine.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, FromContext(c.Request.Context()))
+	})
+
+	for _, tc := range []struct {
+		name   string
+		header string
+		value  string
+		want   string
+	}{
+		{"inbound header", "X-Request-Id", "req-1", "req-1"},
+		{"traceparent", TraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"ignored header", DefaultHeader, "not-configured", ""},
+		{"invalid value", "X-Request-Id", "bad\nid", ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(tc.header, tc.value)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+
+		got := w.Body.String()
+		if w.Header().Get("X-Request-Id") != got {
+			t.Fatalf("%s: response header %q, context %q", tc.name, w.Header().Get("X-Request-Id"), got)
+		}
+		if tc.want != "" && got != tc.want {
+			t.Fatalf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+		if tc.want == "" && len(got) != 26 {
+			t.Fatalf("%s: should generate a ULID, got %q", tc.name, got)
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	ulid := regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)
+	a, b := NewULID(), NewULID()
+	if !ulid.MatchString(a) || a == b || a[:6] != b[:6] {
+		t.Fatalf("unexpected ULIDs %q %q", a, b)
+	}
+	if id := NewW3C(); !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(id) {
+		t.Fatalf("unexpected W3C id %q", id)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var got string
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+	}), WithGenerator(NewW3C))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if len(got) != 32 || w.Header().Get(DefaultHeader) != got {
+		t.Fatalf("context %q, header %q", got, w.Header().Get(DefaultHeader))
+	}
+}
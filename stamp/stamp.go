@@ -0,0 +1,85 @@
+// @desc:   构建信息, 用于在崩溃报告和日志中标记是哪个版本的程序
+// @author: 小肥
+// @date:   2021年04月23日
+// @email:  <2356450144@qq.com>
+
+package stamp
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+// 通过 -ldflags 注入的构建信息, 优先级高于 debug.ReadBuildInfo, 比如:
+//
+//	go build -ldflags "-X github.com/laxiaohong/agave/stamp.Version=v1.0.0 \
+//		-X github.com/laxiaohong/agave/stamp.Revision=$(git rev-parse HEAD) \
+//		-X github.com/laxiaohong/agave/stamp.Dirty=$(test -z "$(git status --porcelain)" && echo false || echo true) \
+//		-X github.com/laxiaohong/agave/stamp.BuildTime=$(date +%FT%T%z)"
+var (
+	Version   string // 发布版本
+	Revision  string // VCS 提交
+	Dirty     string // 构建时工作区是否有未提交的修改, true 或者 false
+	BuildTime string // 构建时间
+)
+
+const _devel = "(devel)" // go build 构建主模块时的版本号
+
+// Info 程序的构建信息
+type Info struct {
+	Module    string `json:"module"`     // 主模块路径
+	Version   string `json:"version"`    // 发布版本
+	Revision  string `json:"revision"`   // VCS 提交
+	Dirty     bool   `json:"dirty"`      // 构建时工作区是否有未提交的修改
+	BuildTime string `json:"build_time"` // 构建时间
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get 获取构建信息, 结果在进程的生命周期内不变
+func Get() Info {
+	once.Do(func() {
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			info.Module = bi.Main.Path
+			if bi.Main.Version != _devel {
+				info.Version = bi.Main.Version
+			}
+			info.Revision, info.BuildTime, info.Dirty = vcsSettings(bi)
+		}
+
+		if Version != "" {
+			info.Version = Version
+		}
+		if Revision != "" {
+			info.Revision = Revision
+		}
+		if Dirty != "" {
+			info.Dirty = Dirty == "true"
+		}
+		if BuildTime != "" {
+			info.BuildTime = BuildTime
+		}
+	})
+	return info
+}
+
+// Release 用于区分不同发布的标识, 优先使用版本号, 没有版本号时使用提交的前 12 位
+func (i Info) Release() string {
+	release := i.Version
+	if release == "" && i.Revision != "" {
+		release = i.Revision
+		if len(release) > 12 {
+			release = release[:12]
+		}
+	}
+	if release == "" {
+		return "unknown"
+	}
+	if i.Dirty {
+		release += "-dirty"
+	}
+	return release
+}
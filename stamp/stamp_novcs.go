@@ -0,0 +1,11 @@
+//go:build !go1.18
+// +build !go1.18
+
+package stamp
+
+import "runtime/debug"
+
+// go1.18 之前构建信息中没有 VCS 信息, 只能通过 -ldflags 注入
+func vcsSettings(bi *debug.BuildInfo) (revision, buildTime string, dirty bool) {
+	return
+}
@@ -0,0 +1,22 @@
+//go:build go1.18
+// +build go1.18
+
+package stamp
+
+import "runtime/debug"
+
+// go1.18 之后 go build 会把 VCS 信息写入构建信息
+// vcs.time 是提交的时间, 没有通过 -ldflags 注入构建时间时作为近似值
+func vcsSettings(bi *debug.BuildInfo) (revision, buildTime string, dirty bool) {
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.time":
+			buildTime = s.Value
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+	return
+}
@@ -9,6 +9,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/laxiaohong/agave/crumb"
+	"github.com/laxiaohong/agave/reqid"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -116,7 +118,7 @@ func (c *Paper) Info(ctx context.Context, msg string, args ...interface{}) {
 		return
 	}
 
-	c.middleEntry(zap.String("trace_id", traceID(ctx))).Printf(c.infoStr+msg, append([]interface{}{utils.FileWithLineNum()}, args...)...)
+	c.middleEntry(contextFields(ctx)...).Printf(c.infoStr+msg, append([]interface{}{utils.FileWithLineNum()}, args...)...)
 }
 
 func (c *Paper) Warn(ctx context.Context, msg string, args ...interface{}) {
@@ -124,7 +126,7 @@ func (c *Paper) Warn(ctx context.Context, msg string, args ...interface{}) {
 		return
 	}
 
-	c.middleEntry(zap.String("trace_id", traceID(ctx))).Printf(c.warnStr+msg, append([]interface{}{utils.FileWithLineNum()}, args...)...)
+	c.middleEntry(contextFields(ctx)...).Printf(c.warnStr+msg, append([]interface{}{utils.FileWithLineNum()}, args...)...)
 
 }
 
@@ -133,18 +135,42 @@ func (c *Paper) Error(ctx context.Context, msg string, args ...interface{}) {
 		return
 	}
 
-	c.middleEntry(zap.String("trace_id", traceID(ctx))).
+	c.middleEntry(contextFields(ctx)...).
 		Printf(c.errStr+msg, append([]interface{}{utils.FileWithLineNum()}, args...)...)
 
 }
 
 func (c *Paper) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	// fc 每次调用都会重新拼接 SQL, 只在需要时调用一次
+	var (
+		sqlText  string
+		affected int64
+		done     bool
+	)
+	query := func() (string, int64) {
+		if !done {
+			sqlText, affected = fc()
+			done = true
+		}
+		return sqlText, affected
+	}
+
+	// 记录到请求的面包屑中, 请求崩溃时由 ject 附加到报告, 与日志级别无关
+	if rec := crumb.FromContext(ctx); rec != nil {
+		sql, rows := query()
+		data := map[string]interface{}{"rows": rows}
+		if err != nil {
+			data["error"] = err.Error()
+		}
+		rec.Add(crumb.Crumb{Category: crumb.CategorySQL, Message: sql, Elapsed: elapsed.String(), Data: data})
+	}
+
 	if c.LogLevel <= gormLogger.Silent {
 		return
 	}
-	elapsed := time.Since(begin)
 	if trace.SpanFromContext(ctx).IsRecording() {
-		sql, cnt := fc()
+		sql, cnt := query()
 		_, span := tracer.Start(ctx, "trace")
 		defer func() {
 			span.End()
@@ -163,30 +189,35 @@ func (c *Paper) Trace(ctx context.Context, begin time.Time, fc func() (string, i
 
 	switch {
 	case err != nil && c.LogLevel >= gormLogger.Error && (!errors.Is(err, gormLogger.ErrRecordNotFound) || !c.IgnoreRecordNotFoundError):
-		sql, rows := fc()
+		sql, rows := query()
 		if rows == -1 {
-			c.middleEntry(zap.String("trace_id", traceID(ctx))).Printf(c.traceErrStr, utils.FileWithLineNum(), err, float64(elapsed.Nanoseconds())/1e6, "-", sql)
+			c.middleEntry(contextFields(ctx)...).Printf(c.traceErrStr, utils.FileWithLineNum(), err, float64(elapsed.Nanoseconds())/1e6, "-", sql)
 		} else {
-			c.middleEntry(zap.String("trace_id", traceID(ctx))).Printf(c.traceErrStr, utils.FileWithLineNum(), err, float64(elapsed.Nanoseconds())/1e6, rows, sql)
+			c.middleEntry(contextFields(ctx)...).Printf(c.traceErrStr, utils.FileWithLineNum(), err, float64(elapsed.Nanoseconds())/1e6, rows, sql)
 		}
 	case elapsed > c.SlowThreshold && c.SlowThreshold != 0 && c.LogLevel >= gormLogger.Warn:
-		sql, rows := fc()
+		sql, rows := query()
 		slowLog := fmt.Sprintf("SLOW SQL >= %v", c.SlowThreshold)
 		if rows == -1 {
-			c.middleEntry(zap.String("trace_id", traceID(ctx))).Printf(c.traceWarnStr, utils.FileWithLineNum(), slowLog, float64(elapsed.Nanoseconds())/1e6, "-", sql)
+			c.middleEntry(contextFields(ctx)...).Printf(c.traceWarnStr, utils.FileWithLineNum(), slowLog, float64(elapsed.Nanoseconds())/1e6, "-", sql)
 		} else {
-			c.middleEntry(zap.String("trace_id", traceID(ctx))).Printf(c.traceWarnStr, utils.FileWithLineNum(), slowLog, float64(elapsed.Nanoseconds())/1e6, rows, sql)
+			c.middleEntry(contextFields(ctx)...).Printf(c.traceWarnStr, utils.FileWithLineNum(), slowLog, float64(elapsed.Nanoseconds())/1e6, rows, sql)
 		}
 	case c.LogLevel == gormLogger.Info:
-		sql, rows := fc()
+		sql, rows := query()
 		if rows == -1 {
-			c.middleEntry(zap.String("trace_id", traceID(ctx))).Printf(c.traceStr, utils.FileWithLineNum(), float64(elapsed.Nanoseconds())/1e6, "-", sql)
+			c.middleEntry(contextFields(ctx)...).Printf(c.traceStr, utils.FileWithLineNum(), float64(elapsed.Nanoseconds())/1e6, "-", sql)
 		} else {
-			c.middleEntry(zap.String("trace_id", traceID(ctx))).Printf(c.traceStr, utils.FileWithLineNum(), float64(elapsed.Nanoseconds())/1e6, rows, sql)
+			c.middleEntry(contextFields(ctx)...).Printf(c.traceStr, utils.FileWithLineNum(), float64(elapsed.Nanoseconds())/1e6, rows, sql)
 		}
 	}
 }
 
+// 从上下文中取出 trace_id 和 request_id
+func contextFields(ctx context.Context) []zap.Field {
+	return []zap.Field{zap.String("trace_id", traceID(ctx)), zap.String("request_id", reqid.FromContext(ctx))}
+}
+
 func traceID(ctx context.Context) string {
 	var traceID string
 	if tid := trace.SpanContextFromContext(ctx).TraceID(); tid.IsValid() {